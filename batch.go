@@ -0,0 +1,203 @@
+package minion
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/dashotv/fae"
+	"github.com/dashotv/minion/database"
+)
+
+// Batch groups jobs so that callbacks can be enqueued when they have
+// all finished. Add jobs with Enqueue, then Close the batch once all
+// of the jobs are added.
+type Batch struct {
+	ID string
+
+	minion *Minion
+	data   *database.Batch
+}
+
+// NewBatch creates a new, open batch.
+func (m *Minion) NewBatch() (*Batch, error) {
+	data := &database.Batch{
+		Client: m.Client,
+		Status: string(database.BatchOpen),
+	}
+	if err := m.db.Batches.Save(data); err != nil {
+		return nil, fae.Wrap(err, "creating batch")
+	}
+
+	return &Batch{ID: data.ID.Hex(), minion: m, data: data}, nil
+}
+
+// OnSuccess sets the payload enqueued when all of the batch's jobs
+// finish without any failures.
+func (b *Batch) OnSuccess(in Payload) error {
+	cb, err := b.callback(in)
+	if err != nil {
+		return err
+	}
+	b.data.OnSuccess = cb
+	return nil
+}
+
+// OnComplete sets the payload enqueued when all of the batch's jobs
+// finish, whether or not they failed.
+func (b *Batch) OnComplete(in Payload) error {
+	cb, err := b.callback(in)
+	if err != nil {
+		return err
+	}
+	b.data.OnComplete = cb
+	return nil
+}
+
+// Enqueue adds a job to the batch.
+func (b *Batch) Enqueue(in Payload) (string, error) {
+	return b.EnqueueWithOptions(in, EnqueueOpts{})
+}
+
+// EnqueueWithOptions adds a job to the batch with the given options,
+// Unique is ignored since a duplicate would not be part of the batch.
+func (b *Batch) EnqueueWithOptions(in Payload, opts EnqueueOpts) (string, error) {
+	opts.Unique = nil
+	opts.batchID = b.ID
+
+	// counted first, so the batch can't finish before the job is counted
+	if err := b.minion.db.AddBatchJobs(context.Background(), b.data, 1); err != nil {
+		return "", err
+	}
+
+	id, err := b.minion.EnqueueWithOptions(in, opts)
+	if err != nil {
+		if uerr := b.minion.db.AddBatchJobs(context.Background(), b.data, -1); uerr != nil {
+			b.minion.Log.Errorf("uncounting batch job: %s", uerr)
+		} else if ferr := b.minion.finishBatch(b.data); ferr != nil {
+			// the batch may have been closed while the job was enqueued
+			b.minion.Log.Errorf("finishing batch: %s", ferr)
+		}
+		return "", err
+	}
+	return id, nil
+}
+
+// Close marks the batch as having all of its jobs added, the callbacks
+// are enqueued once they finish.
+func (b *Batch) Close() error {
+	if err := b.minion.db.CloseBatch(context.Background(), b.data); err != nil {
+		return err
+	}
+	return b.minion.finishBatch(b.data)
+}
+
+func (b *Batch) callback(in Payload) (*database.Callback, error) {
+	if in == nil {
+		return nil, fae.New("payload is nil")
+	}
+
+	args, err := json.Marshal(in)
+	if err != nil {
+		return nil, fae.Wrap(err, "marshaling callback args")
+	}
+
+	return &database.Callback{Kind: in.Kind(), Args: string(args), Queue: b.minion.queueFor(in)}, nil
+}
+
+// recordBatch counts a job that is done toward its batch, and finishes
+// the batch if it was the last job.
+func (m *Minion) recordBatch(d *database.Model) {
+	if d.BatchID == "" {
+		return
+	}
+
+	b, err := m.db.RecordBatchJob(context.Background(), d.BatchID, d.ID.Hex(), database.Status(d.Status).Succeeded())
+	if err != nil {
+		m.Log.Errorf("recording batch job: %s", err)
+		return
+	}
+	if b == nil {
+		// counted already
+		return
+	}
+
+	if err := m.finishBatch(b); err != nil {
+		m.Log.Errorf("finishing batch: %s", err)
+	}
+}
+
+// finishBatch enqueues the batch's callbacks if all of its jobs are done,
+// then sets it to done. The batch stays closed until the callbacks are
+// enqueued, so that the reaper tries again if enqueueing fails.
+func (m *Minion) finishBatch(b *database.Batch) error {
+	// reloads to get the final counts and callbacks
+	ok, err := m.db.BatchComplete(context.Background(), b)
+	if err != nil || !ok {
+		return err
+	}
+
+	if b.OnSuccess != nil && b.Failed == 0 {
+		if err := m.enqueueCallback(b, "success", b.OnSuccess); err != nil {
+			return fae.Wrap(err, "enqueueing success callback")
+		}
+	}
+	if b.OnComplete != nil {
+		if err := m.enqueueCallback(b, "complete", b.OnComplete); err != nil {
+			return fae.Wrap(err, "enqueueing complete callback")
+		}
+	}
+
+	ok, err = m.db.FinishBatch(context.Background(), b)
+	if err != nil || !ok {
+		return err
+	}
+	m.notify("batch:done", b.ID.Hex(), "-")
+	return nil
+}
+
+// finishBatches finishes the client's batches that are complete but not
+// done, whose callbacks failed to be enqueued.
+func (m *Minion) finishBatches(ctx context.Context) error {
+	list, err := m.db.CompleteBatches(ctx, m.Client)
+	if err != nil {
+		return err
+	}
+	for _, b := range list {
+		if err := m.finishBatch(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueueCallback enqueues one of the batch's callbacks. The callback is
+// unique to the batch in every status, since more than one caller can
+// finish the batch, or try again after an error.
+func (m *Minion) enqueueCallback(b *database.Batch, name string, cb *database.Callback) error {
+	data := &database.Model{
+		Client: m.Client,
+		Args:   cb.Args,
+		Kind:   cb.Kind,
+		Status: string(database.StatusPending),
+		Queue:  cb.Queue,
+
+		UniqueKey: "batch:" + b.ID.Hex() + ":" + name,
+	}
+	for _, s := range allUniqueStates {
+		data.UniqueStates = append(data.UniqueStates, string(s))
+	}
+
+	err := m.db.Jobs.Save(data)
+	if mongo.IsDuplicateKeyError(err) {
+		// enqueued already
+		return nil
+	}
+	if err != nil {
+		return fae.Wrap(err, "creating job")
+	}
+
+	m.notify("job:created", data.ID.Hex(), data.Kind)
+	return nil
+}
@@ -0,0 +1,35 @@
+package minion
+
+import (
+	"context"
+
+	"github.com/dashotv/fae"
+	"github.com/dashotv/minion/database"
+)
+
+// errCancelRequested is the cause of a job's context being cancelled by
+// Cancel.
+var errCancelRequested = fae.New("cancel requested")
+
+// Cancel cancels a job. Jobs that haven't been queued are cancelled
+// immediately, queued and running jobs are cancelled by the runner that
+// owns them, which may be in another process. A running job's context
+// is cancelled within HeartbeatInterval, and its attempt finishes as
+// cancelled.
+func (m *Minion) Cancel(jobID string) error {
+	cancelled, err := m.db.RequestCancel(context.Background(), jobID)
+	if err != nil {
+		return fae.Wrap(err, "cancelling job")
+	}
+	if !cancelled {
+		return nil
+	}
+
+	d := &database.Model{}
+	if err := m.db.Jobs.Find(jobID, d); err != nil {
+		return fae.Wrap(err, "finding job")
+	}
+	m.notify("job:cancel", jobID, d.Kind)
+	m.recordBatch(d)
+	return nil
+}
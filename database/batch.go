@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/dashotv/fae"
+	"github.com/dashotv/grimoire"
+)
+
+type BatchStatus string
+
+const (
+	BatchOpen   BatchStatus = "open"   // jobs are still being added
+	BatchClosed BatchStatus = "closed" // all jobs added, waiting for them to finish
+	BatchDone   BatchStatus = "done"   // all jobs finished, callbacks enqueued
+)
+
+// Batch groups jobs by their BatchID, and counts them as they finish.
+type Batch struct {
+	grimoire.Document `bson:",inline"` // includes default model settings
+
+	Client string `bson:"client" json:"client" grimoire:"index"`
+	Status string `bson:"status" json:"status" grimoire:"index"`
+
+	Total     int `bson:"total" json:"total"`
+	Succeeded int `bson:"succeeded" json:"succeeded"`
+	Failed    int `bson:"failed" json:"failed"`
+
+	// Counted are the IDs of the jobs counted in Succeeded or Failed, a
+	// job that runs again after it was counted, e.g. a resurrected job,
+	// is not counted twice.
+	Counted []string `bson:"counted,omitempty" json:"-"`
+
+	// OnSuccess is enqueued when all jobs finish without failures,
+	// OnComplete is enqueued when all jobs finish regardless.
+	OnSuccess  *Callback `bson:"on_success,omitempty" json:"on_success,omitempty"`
+	OnComplete *Callback `bson:"on_complete,omitempty" json:"on_complete,omitempty"`
+}
+
+// Callback is a job to enqueue when a batch finishes.
+type Callback struct {
+	Kind  string `bson:"kind" json:"kind"`
+	Args  string `bson:"args" json:"args"`
+	Queue string `bson:"queue" json:"queue"`
+}
+
+// Pending returns the number of jobs in the batch that have not finished.
+func (b *Batch) Pending() int {
+	return b.Total - b.Succeeded - b.Failed
+}
+
+// AddBatchJobs adds n to the batch's total, n is negative to uncount
+// jobs that failed to be added.
+func (c *Connector) AddBatchJobs(ctx context.Context, b *Batch, n int) error {
+	_, err := c.Batches.Collection.UpdateOne(ctx, bson.M{"_id": b.ID}, bson.M{"$inc": bson.M{"total": n}})
+	if err != nil {
+		return fae.Wrap(err, "updating batch")
+	}
+	return nil
+}
+
+// CloseBatch saves the batch's callbacks and sets it to closed, the
+// counts are not saved since they are updated by the runners.
+func (c *Connector) CloseBatch(ctx context.Context, b *Batch) error {
+	b.Status = string(BatchClosed)
+	set := bson.M{"status": b.Status, "on_success": b.OnSuccess, "on_complete": b.OnComplete}
+	_, err := c.Batches.Collection.UpdateOne(ctx, bson.M{"_id": b.ID}, bson.M{"$set": set})
+	if err != nil {
+		return fae.Wrap(err, "closing batch")
+	}
+	return nil
+}
+
+// RecordBatchJob counts a finished job, and returns the updated batch.
+// Returns nil if the job was already counted.
+func (c *Connector) RecordBatchJob(ctx context.Context, id, jobID string, succeeded bool) (*Batch, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fae.Wrapf(err, "invalid batch id: %s", id)
+	}
+
+	field := "failed"
+	if succeeded {
+		field = "succeeded"
+	}
+
+	b := &Batch{}
+	filter := bson.M{"_id": oid, "counted": bson.M{"$ne": jobID}}
+	update := bson.M{"$inc": bson.M{field: 1}, "$push": bson.M{"counted": jobID}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"counted": 0})
+	err = c.Batches.Collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(b)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fae.Wrap(err, "updating batch")
+	}
+	return b, nil
+}
+
+// completeBatch matches closed batches whose jobs have all finished.
+func completeBatch() bson.M {
+	return bson.M{
+		"status": BatchClosed,
+		"$expr":  bson.M{"$gte": bson.A{bson.M{"$add": bson.A{"$succeeded", "$failed"}}, "$total"}},
+	}
+}
+
+// BatchComplete reloads the batch, and returns true if it is closed and
+// all of its jobs have finished.
+func (c *Connector) BatchComplete(ctx context.Context, b *Batch) (bool, error) {
+	filter := completeBatch()
+	filter["_id"] = b.ID
+	opts := options.FindOne().SetProjection(bson.M{"counted": 0})
+	err := c.Batches.Collection.FindOne(ctx, filter, opts).Decode(b)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, fae.Wrap(err, "finding batch")
+	}
+	return true, nil
+}
+
+// CompleteBatches returns the client's closed batches whose jobs have all
+// finished, but that are not done, their callbacks may not be enqueued.
+func (c *Connector) CompleteBatches(ctx context.Context, client string) ([]*Batch, error) {
+	filter := completeBatch()
+	filter["client"] = client
+	opts := options.Find().SetProjection(bson.M{"counted": 0}).SetLimit(100)
+	cur, err := c.Batches.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fae.Wrap(err, "finding complete batches")
+	}
+	list := []*Batch{}
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, fae.Wrap(err, "finding complete batches")
+	}
+	return list, nil
+}
+
+// FinishBatch sets a closed batch whose jobs have all finished to done,
+// once its callbacks are enqueued. Returns true if this call finished
+// the batch.
+func (c *Connector) FinishBatch(ctx context.Context, b *Batch) (bool, error) {
+	filter := completeBatch()
+	filter["_id"] = b.ID
+	res, err := c.Batches.Collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"status": BatchDone}})
+	if err != nil {
+		return false, fae.Wrap(err, "finishing batch")
+	}
+	return res.ModifiedCount == 1, nil
+}
@@ -2,18 +2,36 @@ package database
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/dashotv/fae"
 	"github.com/dashotv/grimoire"
+	"github.com/kamva/mgm/v3"
 )
 
 type Connector struct {
-	Jobs *grimoire.Store[*Model]
+	Jobs    *grimoire.Store[*Model]
+	Dead    *grimoire.Store[*Model]
+	Batches *grimoire.Store[*Batch]
+	Queues  *grimoire.Store[*QueueState]
+	Locks   *mongo.Collection
+	Limits  *mongo.Collection
+	Slots   *mongo.Collection
 }
 
-func New(uri, db, collection string) (*Connector, error) {
+// New creates a connector for the jobs collection and the dead-letter
+// collection, if dead is empty it defaults to the collection name with
+// a _dead suffix. Batches are stored in the collection name with a
+// _batches suffix, queue states with a _queues suffix, leases with a
+// _locks suffix, rate limit buckets with a _limits suffix, and
+// concurrency slots with a _slots suffix.
+func New(uri, db, collection, dead string) (*Connector, error) {
 	con, err := grimoire.New[*Model](uri, db, collection)
 	if err != nil {
 		return nil, fae.Wrap(err, "creating job store")
@@ -21,21 +39,417 @@ func New(uri, db, collection string) (*Connector, error) {
 	grimoire.CreateIndexes(con, &Model{}, "created_at;updated_at")
 	grimoire.CreateIndexesFromTags(con, &Model{})
 
-	return &Connector{Jobs: con}, nil
+	// supports the producer's query for the next pending jobs
+	_, err = con.Collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "client", Value: 1}, {Key: "queue", Value: 1}, {Key: "status", Value: 1}, {Key: "priority", Value: -1}, {Key: "created_at", Value: 1}},
+	})
+	if err != nil {
+		return nil, fae.Wrap(err, "creating priority index")
+	}
+
+	// enforces unique jobs, only jobs with a unique lock are indexed
+	_, err = con.Collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "unique_lock", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"unique_lock": bson.M{"$gt": ""}}),
+	})
+	if err != nil {
+		return nil, fae.Wrap(err, "creating unique index")
+	}
+
+	if dead == "" {
+		dead = collection + "_dead"
+	}
+	deadCon := newStore[*Model](con, dead)
+	grimoire.CreateIndexes(deadCon, &Model{}, "created_at;updated_at")
+	grimoire.CreateIndexesFromTags(deadCon, &Model{})
+
+	batches := newStore[*Batch](con, collection+"_batches")
+	grimoire.CreateIndexesFromTags(batches, &Batch{})
+
+	queues := newStore[*QueueState](con, collection+"_queues")
+	_, err = queues.Collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "client", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, fae.Wrap(err, "creating queue index")
+	}
+
+	locks := con.Database.Collection(collection + "_locks")
+	limits := con.Database.Collection(collection + "_limits")
+	slots := con.Database.Collection(collection + "_slots")
+
+	return &Connector{Jobs: con, Dead: deadCon, Batches: batches, Queues: queues, Locks: locks, Limits: limits, Slots: slots}, nil
+}
+
+// newStore creates a store for another collection, sharing the jobs
+// store's client and its connection pool.
+func newStore[T mgm.Model](con *grimoire.Store[*Model], collection string) *grimoire.Store[T] {
+	s := &grimoire.Store[T]{
+		Client:     con.Client,
+		Database:   con.Database,
+		Collection: mgm.NewCollection(con.Database, collection),
+	}
+	s.SetQueryDefaults([]bson.M{})
+	return s
 }
 
-func (c *Connector) UpdateAbandonedJobs(ctx context.Context, client string) error {
-	_, err := c.Jobs.Collection.UpdateMany(ctx, bson.M{"client": client, "status": bson.M{"$in": bson.A{StatusRunning, StatusQueued}}}, bson.M{"$set": bson.M{"status": StatusCancelled}, "$push": bson.M{"attempts": bson.M{"error": "minion restarted"}}})
+// UpdateCancelledJobs sets the client's cancelled jobs back to pending,
+// except those that were cancelled on request.
+func (c *Connector) UpdateCancelledJobs(ctx context.Context, client string) (int64, error) {
+	filter := bson.M{"client": client, "status": StatusCancelled, "cancel_requested": bson.M{"$ne": true}}
+	n, err := c.updateEach(ctx, filter, setStatus(StatusPending, nil))
 	if err != nil {
-		return fae.Errorf("querying cancelled jobs: %s", err)
+		return n, fae.Errorf("querying cancelled jobs: %s", err)
+	}
+	return n, nil
+}
+
+// ClaimJob atomically moves the next pending job of the queue to queued
+// and sets its owner, so that a job is only claimed by one instance.
+// Jobs are claimed by priority, then oldest first, jobs of the excluded
+// kinds are skipped. Returns nil if there are no pending jobs.
+func (c *Connector) ClaimJob(ctx context.Context, client, queue, owner string, exclude []string) (*Model, error) {
+	now := time.Now()
+	filter := bson.M{
+		"client": client,
+		"queue":  queue,
+		"status": StatusPending,
+		"$or": bson.A{
+			bson.M{"retry_at": bson.M{"$exists": false}},
+			bson.M{"retry_at": bson.M{"$lte": now}},
+		},
+	}
+	if len(exclude) > 0 {
+		filter["kind"] = bson.M{"$nin": exclude}
+	}
+	update := setStatus(StatusQueued, bson.M{"owner": owner, "heartbeat_at": now, "updated_at": now})
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "created_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	d := &Model{}
+	if err := c.Jobs.Collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(d); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fae.Wrap(err, "claiming job")
+	}
+	return d, nil
+}
+
+// HeartbeatQueued updates the heartbeat of the owner's queued jobs, which
+// are waiting in its queue buffers.
+func (c *Connector) HeartbeatQueued(ctx context.Context, owner string) error {
+	_, err := c.Jobs.Collection.UpdateMany(ctx, bson.M{"owner": owner, "status": StatusQueued}, bson.M{"$set": bson.M{"heartbeat_at": time.Now()}})
+	if err != nil {
+		return fae.Wrap(err, "updating queued heartbeats")
 	}
 	return nil
 }
 
-func (c *Connector) UpdateCancelledJobs(ctx context.Context, client string) (int64, error) {
-	res, err := c.Jobs.Collection.UpdateMany(ctx, bson.M{"client": client, "status": StatusCancelled}, bson.M{"$set": bson.M{"status": StatusPending}})
+// ReleaseStaleQueued sets the client's queued jobs that have not had a
+// heartbeat since the given time, or never had one, back to pending, the
+// instance that claimed them is gone.
+func (c *Connector) ReleaseStaleQueued(ctx context.Context, client string, stale time.Time) (int64, error) {
+	filter := bson.M{"client": client, "status": StatusQueued, "$or": staleHeartbeat(stale)}
+	n, err := c.updateEach(ctx, filter, setStatus(StatusPending, bson.M{"owner": ""}))
+	if err != nil {
+		return n, fae.Wrap(err, "releasing queued jobs")
+	}
+	return n, nil
+}
+
+// Heartbeat updates the heartbeat of a running job, returns true if the
+// job's cancellation has been requested.
+func (c *Connector) Heartbeat(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	d := &Model{}
+	opts := options.FindOneAndUpdate().SetProjection(bson.M{"cancel_requested": 1})
+	err := c.Jobs.Collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "status": StatusRunning}, bson.M{"$set": bson.M{"heartbeat_at": time.Now()}}, opts).Decode(d)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, fae.Wrap(err, "updating heartbeat")
+	}
+	return d.CancelRequested, nil
+}
+
+// ClearCancel clears a job's cancel request, so that it can run again.
+func (c *Connector) ClearCancel(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := c.Jobs.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$unset": bson.M{"cancel_requested": ""}}); err != nil {
+		return fae.Wrap(err, "clearing cancel request")
+	}
+	return nil
+}
+
+// RequestCancel cancels a job, jobs that haven't been claimed are
+// cancelled immediately and true is returned. Queued and running jobs
+// are flagged, their runner cancels them.
+func (c *Connector) RequestCancel(ctx context.Context, id string) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, fae.Wrapf(err, "invalid job id: %s", id)
+	}
+
+	filter := bson.M{"_id": oid, "status": bson.M{"$in": bson.A{StatusWaiting, StatusScheduled, StatusPending}}}
+	res, err := c.Jobs.Collection.UpdateOne(ctx, filter, setStatus(StatusCancelled, bson.M{"cancel_requested": true}))
+	if err != nil {
+		return false, fae.Wrap(err, "cancelling job")
+	}
+	if res.ModifiedCount == 1 {
+		return true, nil
+	}
+
+	filter = bson.M{"_id": oid, "status": bson.M{"$in": bson.A{StatusQueued, StatusRunning}}}
+	res, err = c.Jobs.Collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"cancel_requested": true}})
+	if err != nil {
+		return false, fae.Wrap(err, "requesting cancel")
+	}
+	if res.MatchedCount == 0 {
+		return false, fae.Errorf("job not cancellable: %s", id)
+	}
+	return false, nil
+}
+
+// SetPriority sets a job's priority, without saving the rest of the job
+// that its runner may be updating.
+func (c *Connector) SetPriority(ctx context.Context, id string, priority int) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fae.Wrapf(err, "invalid job id: %s", id)
+	}
+	update := bson.M{"$set": bson.M{"priority": priority, "updated_at": time.Now()}}
+	res, err := c.Jobs.Collection.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		return fae.Wrap(err, "updating priority")
+	}
+	if res.MatchedCount == 0 {
+		return fae.Errorf("job not found: %s", id)
+	}
+	return nil
+}
+
+// ReleaseJobs sets the queued and running jobs back to pending, so that
+// they are claimed again. The last attempt of a running job is removed,
+// it was interrupted and doesn't count toward the job's max attempts.
+func (c *Connector) ReleaseJobs(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	oids, err := objectIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	queued := setStatus(StatusPending, bson.M{"owner": ""})
+	if _, err := c.updateEach(ctx, bson.M{"_id": bson.M{"$in": oids}, "status": StatusQueued}, queued); err != nil {
+		return fae.Wrap(err, "releasing queued jobs")
+	}
+	// drops the last attempt, like $pop which pipelines don't support
+	attempts := bson.M{"$ifNull": bson.A{"$attempts", bson.A{}}}
+	running := setStatus(StatusPending, bson.M{"owner": "", "attempts": bson.M{"$slice": bson.A{
+		attempts, bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{bson.M{"$size": attempts}, 1}}}},
+	}}})
+	if _, err := c.updateEach(ctx, bson.M{"_id": bson.M{"$in": oids}, "status": StatusRunning}, running); err != nil {
+		return fae.Wrap(err, "releasing running jobs")
+	}
+	return nil
+}
+
+// StaleJobs returns the client's running jobs that have not had a
+// heartbeat since the given time, or never had one.
+func (c *Connector) StaleJobs(client string, stale time.Time) ([]*Model, error) {
+	return c.Jobs.Query().
+		Where("client", client).
+		Where("status", StatusRunning).
+		Or(func(q *grimoire.QueryBuilder[*Model]) {
+			q.NotExists("heartbeat_at").LessThan("heartbeat_at", stale)
+		}).
+		Limit(100).Run()
+}
+
+// staleHeartbeat matches jobs that have not had a heartbeat since the
+// given time, or never had one.
+func staleHeartbeat(stale time.Time) bson.A {
+	return bson.A{
+		bson.M{"heartbeat_at": bson.M{"$exists": false}},
+		bson.M{"heartbeat_at": bson.M{"$lt": stale}},
+	}
+}
+
+// RescueJob fails the last attempt of a stale running job and sets the
+// job's status, unless its heartbeat was updated since it was found.
+// Returns true if the job was rescued.
+func (c *Connector) RescueJob(ctx context.Context, d *Model, stale time.Time, status Status, retryAt time.Time) (bool, error) {
+	filter := bson.M{"_id": d.ID, "status": StatusRunning, "$or": staleHeartbeat(stale)}
+	// the update can't be a pipeline, to set the last attempt by index,
+	// the lock is computed from the job that was found instead
+	lock := *d
+	lock.Status = string(status)
+	set := bson.M{"status": status, "retry_at": retryAt, "unique_lock": lock.uniqueLock()}
+	if n := len(d.Attempts); n > 0 {
+		last := fmt.Sprintf("attempts.%d", n-1)
+		set[last+".status"] = StatusFailed
+		set[last+".error"] = "heartbeat lost"
+	}
+
+	res, err := c.Jobs.Collection.UpdateOne(ctx, filter, bson.M{"$set": set})
 	if err != nil {
-		return 0, fae.Errorf("querying cancelled jobs: %s", err)
+		return false, fae.Wrap(err, "rescuing job")
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// PromoteScheduledJobs sets scheduled jobs that are due to pending.
+func (c *Connector) PromoteScheduledJobs(ctx context.Context, client, queue string) (int64, error) {
+	filter := bson.M{"client": client, "queue": queue, "status": StatusScheduled, "run_at": bson.M{"$lte": time.Now()}}
+	n, err := c.updateEach(ctx, filter, setStatus(StatusPending, nil))
+	if err != nil {
+		return n, fae.Errorf("promoting scheduled jobs: %s", err)
+	}
+	return n, nil
+}
+
+// FindUnique returns the job holding the given unique lock.
+func (c *Connector) FindUnique(ctx context.Context, lock string) (*Model, error) {
+	d := &Model{}
+	if err := c.Jobs.Collection.FindOne(ctx, bson.M{"unique_lock": lock}).Decode(d); err != nil {
+		return nil, fae.Wrap(err, "finding unique job")
+	}
+	return d, nil
+}
+
+// JobStatuses returns the status of each of the jobs, including dead
+// jobs. Jobs that no longer exist are not included.
+func (c *Connector) JobStatuses(ctx context.Context, ids []string) (map[string]Status, error) {
+	oids, err := objectIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := map[string]Status{}
+	for _, store := range []*grimoire.Store[*Model]{c.Jobs, c.Dead} {
+		list := []*Model{}
+		err := store.Collection.SimpleFindWithCtx(ctx, &list, bson.M{"_id": bson.M{"$in": oids}}, options.Find().SetProjection(bson.M{"status": 1}))
+		if err != nil {
+			return nil, fae.Wrap(err, "finding jobs")
+		}
+		for _, d := range list {
+			statuses[d.ID.Hex()] = Status(d.Status)
+		}
+	}
+	return statuses, nil
+}
+
+// Kill moves a job to the dead-letter collection, it is removed from
+// the jobs collection. Both steps are idempotent and retried, so a
+// failure can be repaired by calling Kill again.
+func (c *Connector) Kill(ctx context.Context, d *Model) error {
+	d.Status = string(StatusDead)
+	d.UpdatedAt = time.Now().UTC()
+
+	// replace directly, so the mgm hooks don't reset created_at
+	err := retry(ctx, func() error {
+		_, err := c.Dead.Collection.ReplaceOne(ctx, bson.M{"_id": d.ID}, d, options.Replace().SetUpsert(true))
+		return err
+	})
+	if err != nil {
+		return fae.Wrap(err, "inserting dead job")
+	}
+
+	err = retry(ctx, func() error {
+		_, err := c.Jobs.Collection.DeleteOne(ctx, bson.M{"_id": d.ID})
+		return err
+	})
+	if err != nil {
+		return fae.Wrap(err, "deleting dead job")
+	}
+	return nil
+}
+
+// Resurrect moves a job from the dead-letter collection back to the
+// jobs collection as pending. Its attempts are cleared, so that it gets
+// all of its retries again. Both steps are idempotent and retried, a
+// copy left in the jobs collection by a failed Kill is replaced.
+func (c *Connector) Resurrect(ctx context.Context, id string) (*Model, error) {
+	d := &Model{}
+	if err := c.Dead.Find(id, d); err != nil {
+		return nil, fae.Wrap(err, "finding dead job")
+	}
+
+	d.Status = string(StatusPending)
+	d.RetryAt = time.Time{}
+	d.CancelRequested = false
+	d.Attempts = nil
+	d.UpdatedAt = time.Now().UTC()
+	d.UniqueLock = d.uniqueLock()
+
+	err := retry(ctx, func() error {
+		_, err := c.Jobs.Collection.ReplaceOne(ctx, bson.M{"_id": d.ID}, d, options.Replace().SetUpsert(true))
+		return err
+	})
+	if err != nil {
+		return nil, fae.Wrap(err, "inserting job")
+	}
+
+	err = retry(ctx, func() error {
+		_, err := c.Dead.Collection.DeleteOne(ctx, bson.M{"_id": d.ID})
+		return err
+	})
+	if err != nil {
+		return nil, fae.Wrap(err, "deleting dead job")
+	}
+	return d, nil
+}
+
+// retryAttempts is the number of times retry runs an operation.
+const retryAttempts = 3
+
+// retry runs an idempotent operation until it succeeds, up to
+// retryAttempts times. Duplicate key errors are not retried.
+func retry(ctx context.Context, f func() error) error {
+	var err error
+	for i := 0; i < retryAttempts; i++ {
+		if err = f(); err == nil || mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(i+1) * 100 * time.Millisecond):
+		}
+	}
+	return err
+}
+
+// PurgeDead deletes dead jobs last updated before the given time, a
+// zero time deletes all dead jobs. If client is set, only that client's
+// dead jobs are deleted.
+func (c *Connector) PurgeDead(ctx context.Context, client string, before time.Time) (int64, error) {
+	filter := bson.M{}
+	if client != "" {
+		filter["client"] = client
+	}
+	if !before.IsZero() {
+		filter["updated_at"] = bson.M{"$lt": before}
+	}
+	res, err := c.Dead.Collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fae.Errorf("purging dead jobs: %s", err)
+	}
+	return res.DeletedCount, nil
+}
+
+// objectIDs converts job ids to object ids for an $in filter.
+func objectIDs(ids []string) (bson.A, error) {
+	oids := bson.A{}
+	for _, id := range ids {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, fae.Wrapf(err, "invalid job id: %s", id)
+		}
+		oids = append(oids, oid)
 	}
-	return res.ModifiedCount, nil
+	return oids, nil
 }
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/dashotv/fae"
+)
+
+// Lease is a lock held by one owner until it expires, unless the owner
+// renews it.
+type Lease struct {
+	Name      string    `bson:"_id" json:"name"`
+	Owner     string    `bson:"owner" json:"owner"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+// AcquireLease acquires or renews the named lease for the owner, it
+// succeeds if the lease is free, expired, or already held by the owner.
+// Expiry is set and checked with the database's clock, so that clock
+// skew between processes can't make a held lease look expired. Returns
+// true if the owner holds the lease.
+func (c *Connector) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	filter := bson.M{"_id": name, "$expr": bson.M{"$or": bson.A{
+		bson.M{"$eq": bson.A{"$owner", bson.M{"$literal": owner}}},
+		bson.M{"$lt": bson.A{"$expires_at", "$$NOW"}},
+	}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"owner":      bson.M{"$literal": owner},
+			"expires_at": bson.M{"$add": bson.A{"$$NOW", ttl.Milliseconds()}},
+		}}},
+	}
+
+	_, err := c.Locks.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		// the lease exists and is held by another owner, so the upsert
+		// tried to insert a duplicate
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fae.Wrap(err, "acquiring lease")
+	}
+	return true, nil
+}
+
+// ReleaseLease releases the named lease, if it is held by the owner.
+func (c *Connector) ReleaseLease(ctx context.Context, name, owner string) error {
+	if _, err := c.Locks.DeleteOne(ctx, bson.M{"_id": name, "owner": owner}); err != nil {
+		return fae.Wrap(err, "releasing lease")
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/dashotv/fae"
+)
+
+// TakeToken takes a token from the named token bucket, if one is
+// available. The bucket holds up to burst tokens and gains one every
+// interval, it is refilled using the database's clock so that every
+// process shares the same bucket. Returns true if a token was taken.
+func (c *Connector) TakeToken(ctx context.Context, name string, interval time.Duration, burst int) (bool, error) {
+	ms := float64(interval) / float64(time.Millisecond)
+	elapsed := bson.M{"$subtract": bson.A{"$$NOW", bson.M{"$ifNull": bson.A{"$updated_at", "$$NOW"}}}}
+	refill := bson.M{"$min": bson.A{
+		float64(burst),
+		bson.M{"$add": bson.A{
+			bson.M{"$ifNull": bson.A{"$tokens", float64(burst)}},
+			bson.M{"$divide": bson.A{elapsed, ms}},
+		}},
+	}}
+	available := bson.M{"$gte": bson.A{"$tokens", 1}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": refill, "updated_at": "$$NOW"}}},
+		{{Key: "$set", Value: bson.M{
+			"taken":  available,
+			"tokens": bson.M{"$cond": bson.A{available, bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	res := struct {
+		Taken bool `bson:"taken"`
+	}{}
+	if err := c.Limits.FindOneAndUpdate(ctx, bson.M{"_id": name}, pipeline, opts).Decode(&res); err != nil {
+		// another process created the bucket at the same time
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fae.Wrap(err, "taking token")
+	}
+	return res.Taken, nil
+}
+
+// ReturnToken returns an unused token to the named token bucket.
+func (c *Connector) ReturnToken(ctx context.Context, name string, burst int) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": bson.M{"$min": bson.A{float64(burst), bson.M{"$add": bson.A{"$tokens", 1}}}}}}},
+	}
+	if _, err := c.Limits.UpdateOne(ctx, bson.M{"_id": name}, pipeline); err != nil {
+		return fae.Wrap(err, "returning token")
+	}
+	return nil
+}
+
+// TokenAvailable returns true if the named token bucket has a token, it
+// doesn't take it. The refill is estimated with the local clock, so the
+// answer is only a hint, TakeToken decides.
+func (c *Connector) TokenAvailable(ctx context.Context, name string, interval time.Duration) (bool, error) {
+	bucket := struct {
+		Tokens    float64   `bson:"tokens"`
+		UpdatedAt time.Time `bson:"updated_at"`
+	}{}
+	err := c.Limits.FindOne(ctx, bson.M{"_id": name}).Decode(&bucket)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	}
+	if err != nil {
+		return false, fae.Wrap(err, "finding token bucket")
+	}
+
+	tokens := bucket.Tokens + float64(time.Since(bucket.UpdatedAt))/float64(interval)
+	return tokens >= 1, nil
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"time"
 
 	"github.com/dashotv/fae"
@@ -11,6 +12,13 @@ type stackTracer interface {
 	StackTrace() []string
 }
 
+// statusError is implemented by errors that control the status of the
+// attempt, rather than failing it. See minion.JobCancel and friends.
+type statusError interface {
+	error
+	JobStatus() Status
+}
+
 type Model struct {
 	grimoire.Document `bson:",inline"` // includes default model settings
 	//ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
@@ -22,8 +30,78 @@ type Model struct {
 	Args   string `bson:"args,omitempty" json:"args,omitempty"`
 	Queue  string `bson:"queue,omitempty" json:"queue,omitempty"`
 
+	// Priority orders pending jobs within a queue, higher runs first.
+	Priority int `bson:"priority" json:"priority"`
+
 	Status   string     `bson:"status,omitempty" json:"status,omitempty" grimoire:"index"`
 	Attempts []*Attempt `bson:"attempts,omitempty" json:"attempts,omitempty"`
+	Result   string     `bson:"result,omitempty" json:"result,omitempty"`
+	Progress *Progress  `bson:"progress,omitempty" json:"progress,omitempty"`
+
+	// MaxAttempts and Timeout (seconds) override the worker and config
+	// defaults when set.
+	MaxAttempts int `bson:"max_attempts,omitempty" json:"max_attempts,omitempty"`
+	Timeout     int `bson:"timeout,omitempty" json:"timeout,omitempty"`
+
+	Tags    []string `bson:"tags,omitempty" json:"tags,omitempty" grimoire:"index"`
+	BatchID string   `bson:"batch_id,omitempty" json:"batch_id,omitempty" grimoire:"index"`
+
+	// UniqueKey identifies duplicate jobs, while the job's status is one
+	// of UniqueStates the key is copied to UniqueLock, which has a
+	// partial unique index. UniqueLock is not omitempty so that it is
+	// cleared when the job is saved with any other status. Updates that
+	// change the status without saving the job recompute it, see setStatus.
+	UniqueKey    string   `bson:"unique_key,omitempty" json:"unique_key,omitempty"`
+	UniqueStates []string `bson:"unique_states,omitempty" json:"unique_states,omitempty"`
+	UniqueLock   string   `bson:"unique_lock" json:"-"`
+
+	// AfterJobs are the IDs of the jobs that must finish before this job
+	// leaves waiting. If one of them fails, this job is cancelled unless
+	// RunOnParentFailure is set.
+	AfterJobs          []string `bson:"after_jobs,omitempty" json:"after_jobs,omitempty"`
+	RunOnParentFailure bool     `bson:"run_on_parent_failure,omitempty" json:"run_on_parent_failure,omitempty"`
+
+	// CancelRequested is set when a queued or running job is cancelled,
+	// the runner that owns it cancels the job's context.
+	CancelRequested bool `bson:"cancel_requested,omitempty" json:"cancel_requested,omitempty"`
+
+	// Owner is the instance that claimed the job from pending.
+	Owner string `bson:"owner,omitempty" json:"owner,omitempty"`
+
+	// HeartbeatAt is updated while the job is queued or running, jobs
+	// that stop getting heartbeats are rescued.
+	HeartbeatAt time.Time `bson:"heartbeat_at,omitempty" json:"heartbeat_at,omitempty"`
+
+	// RunAt is the time a scheduled job becomes pending.
+	RunAt time.Time `bson:"run_at,omitempty" json:"run_at,omitempty"`
+
+	// RetryAt is the earliest time a failed job will be retried,
+	// not omitempty so that it is cleared when the job is saved.
+	RetryAt time.Time `bson:"retry_at" json:"retry_at"`
+}
+
+// Saving updates the unique lock whenever the job is saved, replaces
+// the mgm hook so it must call it too.
+func (d *Model) Saving() error {
+	if err := d.Document.Saving(); err != nil {
+		return err
+	}
+	d.UniqueLock = d.uniqueLock()
+	return nil
+}
+
+// uniqueLock returns the value of the unique lock for the job's
+// current status.
+func (d *Model) uniqueLock() string {
+	if d.UniqueKey == "" {
+		return ""
+	}
+	for _, s := range d.UniqueStates {
+		if s == d.Status {
+			return d.Client + ":" + d.Kind + ":" + d.UniqueKey
+		}
+	}
+	return ""
 }
 
 func (d *Model) AddAttempt(a *Attempt) int {
@@ -37,12 +115,46 @@ func (d *Model) UpdateAttempt(i int, a *Attempt) {
 	d.Attempts[i] = a
 }
 
+// AttemptCount returns the number of attempts that count toward the
+// job's max attempts, snoozed attempts are not counted.
+func (d *Model) AttemptCount() int {
+	count := 0
+	for _, a := range d.Attempts {
+		if a.Status != string(StatusSnoozed) {
+			count++
+		}
+	}
+	return count
+}
+
+// TrimLogs clears the logs of all but the latest keep attempts, snoozed
+// attempts don't count toward max attempts so their number is unbounded.
+func (d *Model) TrimLogs(keep int) {
+	for i := 0; i < len(d.Attempts)-keep; i++ {
+		d.Attempts[i].Logs = ""
+	}
+}
+
+// Progress is reported by a running job.
+type Progress struct {
+	Percent   int       `bson:"percent" json:"percent"`
+	Message   string    `bson:"message,omitempty" json:"message,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
 type Attempt struct {
 	StartedAt  time.Time `bson:"started_at,omitempty" json:"started_at,omitempty"`
 	Duration   float64   `bson:"duration,omitempty" json:"duration,omitempty"`
 	Status     string    `bson:"status,omitempty" json:"status,omitempty"`
 	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
 	Stacktrace []string  `bson:"stacktrace,omitempty" json:"stacktrace,omitempty"`
+
+	RetryAt     time.Time `bson:"retry_at,omitempty" json:"retry_at,omitempty"`
+	RetryReason string    `bson:"retry_reason,omitempty" json:"retry_reason,omitempty"`
+
+	// Logs are the output of the job's logger during the attempt, left
+	// out of the json since they can be large.
+	Logs string `bson:"logs,omitempty" json:"-"`
 }
 
 func (a *Attempt) Start() {
@@ -59,6 +171,11 @@ func (a *Attempt) Finish(err error) {
 
 	a.Status = string(StatusFailed)
 
+	var se statusError
+	if errors.As(err, &se) {
+		a.Status = string(se.JobStatus())
+	}
+
 	cause := fae.Cause(err)
 	if cause != nil {
 		a.Error = cause.Error()
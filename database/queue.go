@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/dashotv/fae"
+	"github.com/dashotv/grimoire"
+)
+
+// QueueState is the runtime state of a client's queue, shared by all of
+// the client's processes. Every queue has one once a process with it has
+// started.
+type QueueState struct {
+	grimoire.Document `bson:",inline"` // includes default model settings
+
+	Client string `bson:"client" json:"client" grimoire:"index"`
+	Name   string `bson:"name" json:"name"`
+	Paused bool   `bson:"paused" json:"paused"`
+
+	// Concurrency overrides the queue's configured concurrency when set.
+	Concurrency int `bson:"concurrency" json:"concurrency"`
+	// Configured is the queue's configured concurrency, recorded by the
+	// client's processes when they start.
+	Configured int `bson:"configured" json:"configured"`
+}
+
+// SetQueuePaused pauses or resumes the client's queue.
+func (c *Connector) SetQueuePaused(ctx context.Context, client, name string, paused bool) error {
+	return c.setQueueState(ctx, client, name, bson.M{"paused": paused})
+}
+
+// SetQueueConcurrency sets the client's queue concurrency, 0 resets it.
+func (c *Connector) SetQueueConcurrency(ctx context.Context, client, name string, n int) error {
+	return c.setQueueState(ctx, client, name, bson.M{"concurrency": n})
+}
+
+// SetQueueConfigured records the client's queue and its configured
+// concurrency.
+func (c *Connector) SetQueueConfigured(ctx context.Context, client, name string, n int) error {
+	return c.setQueueState(ctx, client, name, bson.M{"configured": n})
+}
+
+// setQueueState updates the client's queue state, it is created if it
+// doesn't exist.
+func (c *Connector) setQueueState(ctx context.Context, client, name string, set bson.M) error {
+	now := time.Now()
+	set["updated_at"] = now
+	update := bson.M{
+		"$set":         set,
+		"$setOnInsert": bson.M{"created_at": now},
+	}
+	_, err := c.Queues.Collection.UpdateOne(ctx, bson.M{"client": client, "name": name}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fae.Wrap(err, "updating queue state")
+	}
+	return nil
+}
+
+// GetQueueState returns the state of the client's queue, the zero state
+// if it has none.
+func (c *Connector) GetQueueState(ctx context.Context, client, name string) (*QueueState, error) {
+	q := &QueueState{Client: client, Name: name}
+	err := c.Queues.Collection.FindOne(ctx, bson.M{"client": client, "name": name}).Decode(q)
+	if err == mongo.ErrNoDocuments {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fae.Wrap(err, "finding queue state")
+	}
+	return q, nil
+}
+
+// ListQueues returns the state of the client's queues, or of all clients'
+// queues if client is empty. Queues that only appear in the jobs, whose
+// processes haven't started since queues were recorded, get the zero
+// state.
+func (c *Connector) ListQueues(ctx context.Context, client string) ([]*QueueState, error) {
+	q := c.Queues.Query().Asc("client").Asc("name")
+	if client != "" {
+		q = q.Where("client", client)
+	}
+	list, err := q.Run()
+	if err != nil {
+		return nil, fae.Wrap(err, "listing queue states")
+	}
+
+	match := bson.M{}
+	if client != "" {
+		match["client"] = client
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"client": "$client", "queue": "$queue"}}}},
+	}
+	cur, err := c.Jobs.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fae.Wrap(err, "listing job queues")
+	}
+	found := []struct {
+		ID struct {
+			Client string `bson:"client"`
+			Queue  string `bson:"queue"`
+		} `bson:"_id"`
+	}{}
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, fae.Wrap(err, "listing job queues")
+	}
+
+	known := map[string]bool{}
+	for _, s := range list {
+		known[s.Client+":"+s.Name] = true
+	}
+	for _, f := range found {
+		if f.ID.Queue == "" || known[f.ID.Client+":"+f.ID.Queue] {
+			continue
+		}
+		list = append(list, &QueueState{Client: f.ID.Client, Name: f.ID.Queue})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Client != list[j].Client {
+			return list[i].Client < list[j].Client
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
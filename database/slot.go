@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/dashotv/fae"
+)
+
+// Slots limits how many jobs hold the named slots at once, each holder
+// expires unless its owner renews it.
+type Slots struct {
+	Name    string        `bson:"_id" json:"name"`
+	Holders []*SlotHolder `bson:"holders" json:"holders"`
+}
+
+// SlotHolder is a job holding one of the slots.
+type SlotHolder struct {
+	JobID     string    `bson:"job_id" json:"job_id"`
+	Owner     string    `bson:"owner" json:"owner"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+// AcquireSlot takes one of the named slots for the job, if fewer than max
+// are held. Expired holders are removed first. Returns true if the job
+// holds a slot.
+func (c *Connector) AcquireSlot(ctx context.Context, name, jobID, owner string, max int, ttl time.Duration) (bool, error) {
+	holder := bson.M{
+		"job_id":     jobID,
+		"owner":      owner,
+		"expires_at": bson.M{"$add": bson.A{"$$NOW", ttl.Milliseconds()}},
+	}
+	active := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$holders", bson.A{}}},
+		"as":    "h",
+		"cond": bson.M{"$and": bson.A{
+			bson.M{"$gt": bson.A{"$$h.expires_at", "$$NOW"}},
+			bson.M{"$ne": bson.A{"$$h.job_id", jobID}},
+		}},
+	}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"holders": active}}},
+		{{Key: "$set", Value: bson.M{"holders": bson.M{"$cond": bson.A{
+			bson.M{"$lt": bson.A{bson.M{"$size": "$holders"}, max}},
+			bson.M{"$concatArrays": bson.A{"$holders", bson.A{holder}}},
+			"$holders",
+		}}}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	s := &Slots{}
+	if err := c.Slots.FindOneAndUpdate(ctx, bson.M{"_id": name}, pipeline, opts).Decode(s); err != nil {
+		// another process created the slots at the same time
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fae.Wrap(err, "acquiring slot")
+	}
+
+	for _, h := range s.Holders {
+		if h.JobID == jobID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ReleaseSlots releases the slots held by the jobs.
+func (c *Connector) ReleaseSlots(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	filter := bson.M{"holders.job_id": bson.M{"$in": ids}}
+	update := bson.M{"$pull": bson.M{"holders": bson.M{"job_id": bson.M{"$in": ids}}}}
+	if _, err := c.Slots.UpdateMany(ctx, filter, update); err != nil {
+		return fae.Wrap(err, "releasing slots")
+	}
+	return nil
+}
+
+// RenewSlots extends the expiry of the slots held by the owner's jobs.
+func (c *Connector) RenewSlots(ctx context.Context, owner string, ttl time.Duration) error {
+	update := bson.M{"$set": bson.M{"holders.$[h].expires_at": time.Now().Add(ttl)}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: bson.A{bson.M{"h.owner": owner}}})
+	if _, err := c.Slots.UpdateMany(ctx, bson.M{"holders.owner": owner}, update, opts); err != nil {
+		return fae.Wrap(err, "renewing slots")
+	}
+	return nil
+}
+
+// SlotsHeld returns the number of unexpired holders of each of the named
+// slots.
+func (c *Connector) SlotsHeld(ctx context.Context, names []string) (map[string]int, error) {
+	cur, err := c.Slots.Find(ctx, bson.M{"_id": bson.M{"$in": names}})
+	if err != nil {
+		return nil, fae.Wrap(err, "finding slots")
+	}
+	list := []*Slots{}
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, fae.Wrap(err, "decoding slots")
+	}
+
+	now := time.Now()
+	held := map[string]int{}
+	for _, s := range list {
+		for _, h := range s.Holders {
+			if h.ExpiresAt.After(now) {
+				held[s.Name]++
+			}
+		}
+	}
+	return held, nil
+}
@@ -3,6 +3,8 @@ package database
 type Status string
 
 const (
+	StatusWaiting   Status = "waiting"
+	StatusScheduled Status = "scheduled"
 	StatusPending   Status = "pending"
 	StatusQueued    Status = "queued"
 	StatusRunning   Status = "running"
@@ -10,4 +12,21 @@ const (
 	StatusFinished  Status = "finished"
 	StatusCancelled Status = "cancelled"
 	StatusArchived  Status = "archived"
+	StatusDiscarded Status = "discarded"
+	StatusSnoozed   Status = "snoozed"
+	StatusDead      Status = "dead"
 )
+
+// Done returns true if a job with this status will not run again.
+func (s Status) Done() bool {
+	switch s {
+	case StatusFinished, StatusFailed, StatusCancelled, StatusArchived, StatusDiscarded, StatusDead:
+		return true
+	}
+	return false
+}
+
+// Succeeded returns true if a job with this status finished successfully.
+func (s Status) Succeeded() bool {
+	return s == StatusFinished
+}
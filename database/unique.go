@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/dashotv/fae"
+)
+
+// lockExpr returns the aggregation expression of the unique lock of a
+// job moving to the given status, it mirrors Model.uniqueLock for
+// updates that don't load the job.
+func lockExpr(status Status) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$and": bson.A{
+			bson.M{"$gt": bson.A{"$unique_key", ""}},
+			bson.M{"$in": bson.A{string(status), bson.M{"$ifNull": bson.A{"$unique_states", bson.A{}}}}},
+		}},
+		bson.M{"$concat": bson.A{"$client", ":", "$kind", ":", "$unique_key"}},
+		"",
+	}}
+}
+
+// setStatus returns a pipeline update that sets the job's status and the
+// given fields, and recomputes its unique lock for the new status.
+func setStatus(status Status, set bson.M) mongo.Pipeline {
+	fields := bson.M{"status": status, "unique_lock": lockExpr(status)}
+	for k, v := range set {
+		fields[k] = v
+	}
+	return mongo.Pipeline{{{Key: "$set", Value: fields}}}
+}
+
+// updateEach applies the update to each job matching the filter, one at
+// a time, so that a job whose new unique lock is held by a duplicate is
+// skipped, and left as it was, instead of failing the others. Returns
+// the number of jobs updated.
+func (c *Connector) updateEach(ctx context.Context, filter bson.M, update any) (int64, error) {
+	cur, err := c.Jobs.Collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	list := []*Model{}
+	if err := cur.All(ctx, &list); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for _, d := range list {
+		f := bson.M{"_id": d.ID}
+		for k, v := range filter {
+			f[k] = v
+		}
+		res, err := c.Jobs.Collection.UpdateOne(ctx, f, update)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		count += res.ModifiedCount
+	}
+	return count, nil
+}
+
+// SetStatuses moves all of the jobs with one status to another.
+func (c *Connector) SetStatuses(ctx context.Context, from, to Status) (int64, error) {
+	n, err := c.updateEach(ctx, bson.M{"status": from}, setStatus(to, nil))
+	if err != nil {
+		return n, fae.Wrapf(err, "setting %s jobs to %s", from, to)
+	}
+	return n, nil
+}
+
+// PromoteWaitingJob moves a waiting job to the given status, returns
+// false if it was no longer waiting or a duplicate holds its lock. A job
+// cancelled because a parent failed is flagged like a requested cancel,
+// so that RetryCanceled doesn't resume it.
+func (c *Connector) PromoteWaitingJob(ctx context.Context, id primitive.ObjectID, status Status) (bool, error) {
+	set := bson.M{}
+	if status == StatusCancelled {
+		set["cancel_requested"] = true
+	}
+	res, err := c.Jobs.Collection.UpdateOne(ctx, bson.M{"_id": id, "status": StatusWaiting}, setStatus(status, set))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fae.Wrap(err, "updating waiting job")
+	}
+	return res.ModifiedCount == 1, nil
+}
@@ -0,0 +1,116 @@
+package minion
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/dashotv/fae"
+	"github.com/dashotv/minion/database"
+)
+
+// waitingBatch is the number of waiting jobs checked at a time.
+const waitingBatch = 100
+
+// promoteWaiting checks the jobs waiting on other jobs, and sets them
+// to pending (or scheduled) once all of their parents are done. If a
+// parent failed, the job is cancelled unless RunOnParentFailure is set.
+// All waiting jobs are checked, a page at a time by id, so jobs whose
+// parents are done aren't held back by older jobs that are still blocked.
+func (p *Producer) promoteWaiting() error {
+	var last primitive.ObjectID
+	for {
+		list, err := p.Minion.db.Jobs.Query().
+			Where("client", p.Minion.Client).
+			Where("queue", p.Queue.Name).
+			Where("status", database.StatusWaiting).
+			GreaterThan("_id", last).
+			Asc("_id").Limit(waitingBatch).Run()
+		if err != nil {
+			return fae.Wrap(err, "querying waiting jobs")
+		}
+		if len(list) == 0 {
+			return nil
+		}
+		last = list[len(list)-1].ID
+
+		if err := p.promotePage(list); err != nil {
+			return err
+		}
+		if len(list) < waitingBatch {
+			return nil
+		}
+	}
+}
+
+// promotePage promotes a page of waiting jobs, the statuses of all of
+// their parents are found at once.
+func (p *Producer) promotePage(list []*database.Model) error {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, j := range list {
+		for _, id := range j.AfterJobs {
+			// invalid ids are rejected on enqueue, skip any that got in
+			// so they don't block the whole page
+			if seen[id] || !primitive.IsValidObjectID(id) {
+				continue
+			}
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	statuses, err := p.Minion.db.JobStatuses(context.Background(), ids)
+	if err != nil {
+		return fae.Wrap(err, "checking dependencies")
+	}
+
+	for _, j := range list {
+		status := dependencyStatus(j, statuses)
+		if status == database.StatusWaiting {
+			continue
+		}
+
+		ok, err := p.Minion.db.PromoteWaitingJob(context.Background(), j.ID, status)
+		if err != nil {
+			return err
+		}
+
+		if ok && status == database.StatusCancelled {
+			p.Minion.notify("job:cancel", j.ID.Hex(), j.Kind)
+			j.Status = string(status)
+			p.Minion.recordBatch(j)
+		}
+	}
+
+	return nil
+}
+
+// dependencyStatus returns the status the waiting job should move to,
+// or waiting if any of its parents are not done. Parents that no
+// longer exist are treated as finished.
+func dependencyStatus(j *database.Model, statuses map[string]database.Status) database.Status {
+	failed := false
+	for _, id := range j.AfterJobs {
+		s, ok := statuses[id]
+		if !ok {
+			continue
+		}
+		if !s.Done() {
+			return database.StatusWaiting
+		}
+		if !s.Succeeded() {
+			failed = true
+		}
+	}
+
+	switch {
+	case failed && !j.RunOnParentFailure:
+		return database.StatusCancelled
+	case j.RunAt.After(time.Now()):
+		return database.StatusScheduled
+	default:
+		return database.StatusPending
+	}
+}
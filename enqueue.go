@@ -1,26 +1,106 @@
 package minion
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/dashotv/fae"
 	"github.com/dashotv/minion/database"
 )
 
+// EnqueueOpts are the per-call options for EnqueueWithOptions, zero
+// values fall back to the worker's registration and the config.
+type EnqueueOpts struct {
+	// Queue overrides the queue the worker is registered with.
+	Queue string
+	// Priority orders jobs within a queue, higher runs first.
+	Priority int
+	// RunAt schedules the job to run no earlier than the given time.
+	RunAt time.Time
+	// MaxAttempts overrides the worker and config max attempts.
+	MaxAttempts int
+	// Timeout overrides the worker and config timeout, it is stored in
+	// whole seconds, rounded up.
+	Timeout time.Duration
+	// Tags are stored with the job, for filtering in the server.
+	Tags []string
+	// AfterJobs are the IDs of jobs that must finish before the job runs,
+	// it waits until they are all done.
+	AfterJobs []string
+	// RunOnParentFailure runs the job even if one of AfterJobs fails,
+	// otherwise the job is cancelled.
+	RunOnParentFailure bool
+	// Unique deduplicates the job, if a duplicate exists its ID is
+	// returned instead of enqueueing a new job.
+	Unique *UniqueOpts
+
+	// batchID is set when enqueued by a Batch.
+	batchID string
+}
+
 func (m *Minion) Enqueue(in Payload) error {
 	_, err := m.EnqueueID(in)
 	return err
 }
 
 func (m *Minion) EnqueueID(in Payload) (string, error) {
-	queue := "default"
+	return m.EnqueueWithOptions(in, EnqueueOpts{})
+}
 
-	reg := m.workers[in.Kind()]
-	if reg.queue != "" {
-		queue = reg.queue
+// EnqueueWithPriority enqueues a job with the given priority, higher
+// priority jobs are run before older jobs in the same queue.
+func (m *Minion) EnqueueWithPriority(in Payload, priority int) (string, error) {
+	return m.EnqueueWithOptions(in, EnqueueOpts{Priority: priority})
+}
+
+// EnqueueAt enqueues a job that will not run before the given time.
+func (m *Minion) EnqueueAt(in Payload, at time.Time) (string, error) {
+	return m.EnqueueWithOptions(in, EnqueueOpts{RunAt: at})
+}
+
+// EnqueueIn enqueues a job that will not run until after the given
+// duration.
+func (m *Minion) EnqueueIn(in Payload, d time.Duration) (string, error) {
+	return m.EnqueueAt(in, time.Now().Add(d))
+}
+
+// EnqueueWithOptions enqueues a job, overriding the defaults with the
+// given options. All of the options are stored with the job.
+func (m *Minion) EnqueueWithOptions(in Payload, opts EnqueueOpts) (string, error) {
+	data, err := m.newJob(in, opts)
+	if err != nil {
+		return "", err
 	}
 
-	return m.enqueueToID(queue, in)
+	// the duplicate can finish between the insert and the find, in
+	// which case the insert is tried again
+	for i := 0; i < 2; i++ {
+		err = m.db.Jobs.Save(data)
+		if mongo.IsDuplicateKeyError(err) && data.UniqueLock != "" {
+			existing, err := m.db.FindUnique(context.Background(), data.UniqueLock)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			if err != nil {
+				return "", fae.Wrap(err, "finding duplicate job")
+			}
+			return existing.ID.Hex(), nil
+		}
+		if err != nil {
+			return "", fae.Wrap(err, "creating job")
+		}
+
+		m.notify("job:created", data.ID.Hex(), data.Kind)
+		return data.ID.Hex(), nil
+	}
+
+	return "", fae.Wrap(err, "creating unique job")
 }
 
 func (m *Minion) Requeue(jobID string) error {
@@ -30,7 +110,15 @@ func (m *Minion) Requeue(jobID string) error {
 		return fae.Wrap(err, "finding job")
 	}
 
+	// cleared first, saving doesn't unset it and the runner would cancel
+	// the job again
+	if err := m.db.ClearCancel(context.Background(), job.ID); err != nil {
+		return fae.Wrap(err, "updating job")
+	}
+
 	job.Status = string(database.StatusPending)
+	job.RetryAt = time.Time{}
+	job.CancelRequested = false
 	err = m.db.Jobs.Save(job)
 	if err != nil {
 		return fae.Wrap(err, "updating job")
@@ -46,28 +134,74 @@ func (m *Minion) enqueueTo(queue string, in Payload) error {
 }
 
 func (m *Minion) enqueueToID(queue string, in Payload) (string, error) {
+	return m.EnqueueWithOptions(in, EnqueueOpts{Queue: queue})
+}
+
+// newJob builds the job model for the payload and options.
+func (m *Minion) newJob(in Payload, opts EnqueueOpts) (*database.Model, error) {
 	if in == nil {
-		return "", fae.New("payload is nil")
+		return nil, fae.New("payload is nil")
+	}
+
+	if opts.Timeout < 0 {
+		return nil, fae.Errorf("invalid timeout: %s", opts.Timeout)
+	}
+
+	for _, id := range opts.AfterJobs {
+		if !primitive.IsValidObjectID(id) {
+			return nil, fae.Errorf("invalid after job id: %s", id)
+		}
 	}
 
 	args, err := json.Marshal(in)
 	if err != nil {
-		return "", fae.Wrap(err, "marshaling job args")
+		return nil, fae.Wrap(err, "marshaling job args")
+	}
+
+	queue := opts.Queue
+	if queue == "" {
+		queue = m.queueFor(in)
 	}
 
 	data := &database.Model{
-		Client: m.Client,
-		Args:   string(args),
-		Kind:   in.Kind(),
-		Status: string(database.StatusPending),
-		Queue:  queue,
+		Client:      m.Client,
+		Args:        string(args),
+		Kind:        in.Kind(),
+		Status:      string(database.StatusPending),
+		Queue:       queue,
+		Priority:    opts.Priority,
+		MaxAttempts: opts.MaxAttempts,
+		Timeout:     int(math.Ceil(opts.Timeout.Seconds())),
+		Tags:        opts.Tags,
+		BatchID:     opts.batchID,
+
+		AfterJobs:          opts.AfterJobs,
+		RunOnParentFailure: opts.RunOnParentFailure,
+	}
+	if opts.RunAt.After(time.Now()) {
+		data.Status = string(database.StatusScheduled)
+		data.RunAt = opts.RunAt
+	}
+	if len(opts.AfterJobs) > 0 {
+		data.Status = string(database.StatusWaiting)
+	}
+	if opts.Unique != nil {
+		opts.Unique.apply(data)
 	}
 
-	err = m.db.Jobs.Save(data)
-	if err != nil {
-		return "", fae.Wrap(err, "creating job")
+	return data, nil
+}
+
+// queueFor returns the queue the payload's worker is registered with.
+func (m *Minion) queueFor(in Payload) string {
+	queue := "default"
+	if in == nil {
+		return queue
 	}
 
-	m.notify("job:created", data.ID.Hex(), data.Kind)
-	return data.ID.Hex(), nil
+	reg := m.workers[in.Kind()]
+	if reg.queue != "" {
+		queue = reg.queue
+	}
+	return queue
 }
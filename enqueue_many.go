@@ -0,0 +1,89 @@
+package minion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/dashotv/fae"
+	"github.com/dashotv/minion/database"
+)
+
+// EnqueueManyError reports the payloads that failed to enqueue, keyed
+// by their index in the list passed to EnqueueMany.
+type EnqueueManyError struct {
+	Total  int
+	Errors map[int]error
+}
+
+func (e *EnqueueManyError) Error() string {
+	return fmt.Sprintf("enqueueing %d of %d jobs failed", len(e.Errors), e.Total)
+}
+
+// EnqueueMany enqueues a list of jobs with a single bulk insert. The
+// returned IDs are in the same order as the payloads, if some of the
+// jobs fail the error is an *EnqueueManyError and their IDs are empty.
+func (m *Minion) EnqueueMany(list []Payload) ([]string, error) {
+	ids := make([]string, len(list))
+	failed := map[int]error{}
+
+	docs := []interface{}{}
+	index := []int{} // maps position in docs to position in list
+	for i, in := range list {
+		data, err := m.newJob(in, EnqueueOpts{})
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+		if err := prepareInsert(data); err != nil {
+			failed[i] = err
+			continue
+		}
+
+		ids[i] = data.ID.Hex()
+		docs = append(docs, data)
+		index = append(index, i)
+	}
+
+	if len(docs) > 0 {
+		_, err := m.db.Jobs.Collection.InsertMany(context.Background(), docs, options.InsertMany().SetOrdered(false))
+		var bwe mongo.BulkWriteException
+		if errors.As(err, &bwe) {
+			for _, we := range bwe.WriteErrors {
+				i := index[we.Index]
+				ids[i] = ""
+				failed[i] = fae.Wrap(we, "creating job")
+			}
+		} else if err != nil {
+			return nil, fae.Wrap(err, "creating jobs")
+		}
+	}
+
+	for i, id := range ids {
+		if id != "" {
+			m.notify("job:created", id, list[i].Kind())
+		}
+	}
+
+	if len(failed) > 0 {
+		return ids, &EnqueueManyError{Total: len(list), Errors: failed}
+	}
+	return ids, nil
+}
+
+// prepareInsert does what mgm does before a create, for inserts that
+// don't go through mgm.
+func prepareInsert(data *database.Model) error {
+	if err := data.Creating(); err != nil {
+		return fae.Wrap(err, "creating job")
+	}
+	if err := data.Saving(); err != nil {
+		return fae.Wrap(err, "saving job")
+	}
+	data.ID = primitive.NewObjectID()
+	return nil
+}
@@ -0,0 +1,33 @@
+package minion
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewJobTimeout(t *testing.T) {
+	m := &Minion{workers: map[string]registration{}}
+
+	cases := []struct {
+		timeout time.Duration
+		want    int
+	}{
+		{0, 0},
+		{500 * time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+	}
+	for _, c := range cases {
+		d, err := m.newJob(&countPayload{}, EnqueueOpts{Timeout: c.timeout})
+		if err != nil {
+			t.Fatalf("newJob(%s): %s", c.timeout, err)
+		}
+		if d.Timeout != c.want {
+			t.Errorf("newJob(%s) timeout = %d, want %d", c.timeout, d.Timeout, c.want)
+		}
+	}
+
+	if _, err := m.newJob(&countPayload{}, EnqueueOpts{Timeout: -time.Second}); err == nil {
+		t.Error("newJob with negative timeout, want error")
+	}
+}
@@ -0,0 +1,68 @@
+package minion
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/dashotv/fae"
+)
+
+type txKey struct{}
+
+// txNotifications collects the notifications for jobs enqueued in a
+// transaction, so they are only sent after it commits.
+type txNotifications struct {
+	list []*Notification
+}
+
+// MongoClient returns the client behind the jobs collection, sessions
+// passed to EnqueueTx must be started from this client.
+func (m *Minion) MongoClient() *mongo.Client {
+	return m.db.Jobs.Client
+}
+
+// EnqueueTx enqueues a job inside the caller's transaction, so the job
+// is only created if the transaction commits. The job:created
+// notification is only sent when the transaction is run by
+// WithTransaction, otherwise the producer finds the job when it polls.
+// Unique jobs are not deduplicated, a duplicate aborts the transaction.
+func (m *Minion) EnqueueTx(ctx mongo.SessionContext, in Payload) (string, error) {
+	data, err := m.newJob(in, EnqueueOpts{})
+	if err != nil {
+		return "", err
+	}
+
+	err = m.db.Jobs.Collection.CreateWithCtx(ctx, data)
+	if err != nil {
+		return "", fae.Wrap(err, "creating job")
+	}
+
+	if tx, ok := ctx.Value(txKey{}).(*txNotifications); ok {
+		tx.list = append(tx.list, &Notification{"job:created", data.ID.Hex(), data.Kind})
+	}
+	return data.ID.Hex(), nil
+}
+
+// WithTransaction runs f in a transaction on the minion's client, jobs
+// enqueued with EnqueueTx inside f are notified after the commit.
+func (m *Minion) WithTransaction(ctx context.Context, f func(ctx mongo.SessionContext) error) error {
+	tx := &txNotifications{}
+	ctx = context.WithValue(ctx, txKey{}, tx)
+
+	err := m.db.Jobs.Client.UseSession(ctx, func(sctx mongo.SessionContext) error {
+		_, err := sctx.WithTransaction(sctx, func(sctx mongo.SessionContext) (interface{}, error) {
+			tx.list = nil // the transaction may be retried
+			return nil, f(sctx)
+		})
+		return err
+	})
+	if err != nil {
+		return fae.Wrap(err, "running transaction")
+	}
+
+	for _, n := range tx.list {
+		m.notify(n.Event, n.JobID, n.Kind)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package minion
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dashotv/fae"
+	"github.com/dashotv/minion/database"
+)
+
+// controlError is returned from a worker's Work method to control what
+// happens to the job, rather than counting as a failed attempt.
+type controlError struct {
+	status database.Status
+	err    error
+	snooze time.Duration
+}
+
+func (e *controlError) Error() string {
+	return fmt.Sprintf("%s: %s", e.status, e.err)
+}
+
+func (e *controlError) Unwrap() error {
+	return e.err
+}
+
+// JobStatus is the status the attempt will be finished with.
+func (e *controlError) JobStatus() database.Status {
+	return e.status
+}
+
+// JobCancel returns an error that permanently cancels the job, it will
+// not be retried.
+func JobCancel(err error) error {
+	if err == nil {
+		err = fae.New("cancelled")
+	}
+	return fae.Wrap(&controlError{status: database.StatusCancelled, err: err}, "job cancel")
+}
+
+// JobDiscard returns an error that discards the job, it is removed from
+// the database.
+func JobDiscard(err error) error {
+	if err == nil {
+		err = fae.New("discarded")
+	}
+	return fae.Wrap(&controlError{status: database.StatusDiscarded, err: err}, "job discard")
+}
+
+// JobSnooze returns an error that reschedules the job to run again
+// after d, the attempt does not count toward the job's max attempts.
+func JobSnooze(d time.Duration) error {
+	err := fae.Errorf("snoozed for %s", d)
+	return fae.Wrap(&controlError{status: database.StatusSnoozed, err: err, snooze: d}, "job snooze")
+}
+
+// errSnoozed is returned by the runner for a snoozed job, it is neither
+// a success nor a failure.
+var errSnoozed = fae.New("job snoozed")
+
+// snoozeDuration returns the snooze duration from a JobSnooze error.
+func snoozeDuration(err error) time.Duration {
+	var ce *controlError
+	if errors.As(err, &ce) {
+		return ce.snooze
+	}
+	return 0
+}
@@ -7,6 +7,7 @@ require (
 	github.com/dashotv/fae v0.1.10
 	github.com/dashotv/grimoire v0.5.14
 	github.com/dotenv-org/godotenvvault v0.6.0
+	github.com/kamva/mgm/v3 v3.5.0
 	github.com/labstack/echo/v4 v4.11.4
 	github.com/robfig/cron/v3 v3.0.1
 	github.com/streamingfast/logging v0.0.0-20230608130331-f22c91403091
@@ -36,7 +37,6 @@ require (
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/joeshaw/multierror v0.0.0-20140124173710-69b34d4ec901 // indirect
 	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/kamva/mgm/v3 v3.5.0 // indirect
 	github.com/klauspost/compress v1.17.11 // indirect
 	github.com/labstack/echo-jwt/v4 v4.2.0 // indirect
 	github.com/labstack/gommon v0.4.2 // indirect
@@ -57,24 +57,12 @@ func main() {
 		}
 	}()
 	go func() {
-		for i := 0; i < 100; i++ {
-			err := min.Enqueue(&Number{Number: i})
-			if err != nil {
-				min.Log.Errorf("enqueuing job: %s", err)
-			}
-		}
-		min.Log.Info("jobs queued")
+		enqueueNumbers(min, 100)
 	}()
 	go func() {
 		select {
 		case <-time.After(25 * time.Second):
-			for i := 0; i < 100; i++ {
-				err := min.Enqueue(&Number{Number: i})
-				if err != nil {
-					min.Log.Errorf("enqueuing job: %s", err)
-				}
-			}
-			min.Log.Info("jobs queued")
+			enqueueNumbers(min, 100)
 		case <-ctx.Done():
 			return
 		}
@@ -89,7 +77,23 @@ func main() {
 		fmt.Println("context done")
 	}
 
-	min.Stop()
+	if err := min.Stop(context.Background()); err != nil {
+		fmt.Printf("stop: %s\n", err)
+	}
+}
+
+func enqueueNumbers(min *minion.Minion, count int) {
+	list := make([]minion.Payload, count)
+	for i := 0; i < count; i++ {
+		list[i] = &Number{Number: i}
+	}
+
+	_, err := min.EnqueueMany(list)
+	if err != nil {
+		min.Log.Errorf("enqueuing jobs: %s", err)
+		return
+	}
+	min.Log.Info("jobs queued")
 }
 
 func Fatal(format string, err error) {
@@ -151,7 +155,12 @@ func (b *Sleeper) Timeout(*minion.Job[*Sleeper]) time.Duration {
 }
 func (b *Sleeper) Work(ctx context.Context, job *minion.Job[*Sleeper]) error {
 	fmt.Printf("both: sleep %d\n", job.Args.Seconds)
-	time.Sleep(time.Duration(job.Args.Seconds) * time.Second)
+	for i := 0; i < job.Args.Seconds; i++ {
+		time.Sleep(time.Second)
+		if err := job.Progress(ctx, (i+1)*100/job.Args.Seconds, "sleeping"); err != nil {
+			return err
+		}
+	}
 	fmt.Printf("both: done %d\n", job.Args.Seconds)
 	return nil
 }
@@ -165,7 +174,7 @@ func (n *Number) Kind() string { return "number" }
 func (n *Number) Work(ctx context.Context, job *minion.Job[*Number]) error {
 	i := rand.Intn(5)
 	time.Sleep(time.Duration(i) * time.Second)
-	fmt.Printf("number: %d %d\n", job.Args.Number, i)
+	job.Log().Infof("number: %d %d", job.Args.Number, i)
 	if i == 4 {
 		return fae.New("random error")
 	}
@@ -176,7 +185,7 @@ func (n *Number) Work(ctx context.Context, job *minion.Job[*Number]) error {
 }
 
 func resetDatabase() error {
-	con, err := database.New(mongoURI, mongoDatabase, mongoCollection)
+	con, err := database.New(mongoURI, mongoDatabase, mongoCollection, "")
 	if err != nil {
 		return fae.Wrap(err, "creating database")
 	}
@@ -0,0 +1,59 @@
+package minion
+
+import (
+	"context"
+	"time"
+)
+
+// leaseName returns the name of the lease that elects the client's cron
+// leader.
+func (m *Minion) leaseName() string {
+	return "cron:" + m.Client
+}
+
+// lead runs the cron scheduler while this instance holds the client's
+// cron lease, so that scheduled jobs are enqueued once across all the
+// client's replicas. The lease is renewed at a third of its TTL, followers
+// keep trying to acquire it and take over once it expires. The lease is
+// released when the context is done.
+func (m *Minion) lead(ctx context.Context) {
+	ttl := time.Duration(m.Config.LeaderLease) * time.Second
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	leader := false
+	defer func() {
+		if !leader {
+			return
+		}
+		m.cron.Stop()
+		if err := m.db.ReleaseLease(context.Background(), m.leaseName(), m.Instance); err != nil {
+			m.Log.Errorf("leader: %s", err)
+		}
+	}()
+
+	for {
+		ok, err := m.db.AcquireLease(ctx, m.leaseName(), m.Instance, ttl)
+		if err != nil {
+			// can't tell if the lease was renewed, assume the worst
+			m.Log.Errorf("leader: %s", err)
+			ok = false
+		}
+
+		switch {
+		case ok && !leader:
+			m.Log.Infof("leader: acquired cron lease")
+			m.cron.Start()
+		case !ok && leader:
+			m.Log.Warnf("leader: lost cron lease")
+			m.cron.Stop()
+		}
+		leader = ok
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
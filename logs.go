@@ -0,0 +1,79 @@
+package minion
+
+import (
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// logBuffer is a bounded buffer for a job attempt's logs. Once full it
+// keeps the first and last half of the limit, and drops the middle,
+// since the start and end of a job's logs are the most useful.
+type logBuffer struct {
+	mu      sync.Mutex
+	limit   int
+	head    []byte
+	tail    []byte
+	dropped int
+}
+
+func newLogBuffer(limit int) *logBuffer {
+	return &logBuffer{limit: limit}
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	half := b.limit / 2
+	if room := half - len(b.head); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.head = append(b.head, p[:room]...)
+		p = p[room:]
+	}
+
+	b.tail = append(b.tail, p...)
+	if over := len(b.tail) - (b.limit - half); over > 0 {
+		b.tail = b.tail[over:]
+		b.dropped += over
+	}
+	return n, nil
+}
+
+func (b *logBuffer) Sync() error {
+	return nil
+}
+
+// String returns the logs, with a marker where they were truncated.
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.dropped == 0 {
+		return string(b.head) + string(b.tail)
+	}
+	return fmt.Sprintf("%s\n... [truncated %d bytes] ...\n%s", b.head, b.dropped, b.tail)
+}
+
+// attemptLogger returns a logger that writes to the minion's logger and
+// to the buffer, which is saved with the attempt.
+func (m *Minion) attemptLogger(buf *logBuffer, jobID, kind string) *zap.SugaredLogger {
+	enc := zap.NewProductionEncoderConfig()
+	enc.EncodeTime = zapcore.ISO8601TimeEncoder
+	core := zapcore.NewCore(zapcore.NewConsoleEncoder(enc), buf, zapcore.DebugLevel)
+
+	base := zap.NewNop()
+	if m.Log != nil {
+		base = m.Log.Desugar()
+	}
+
+	log := base.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(c, core)
+	}))
+	return log.Sugar().Named("job").With("job", jobID, "kind", kind)
+}
@@ -0,0 +1,40 @@
+package minion
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dashotv/minion/database"
+)
+
+func TestLogBuffer(t *testing.T) {
+	b := newLogBuffer(10)
+	b.Write([]byte("abc"))
+	if got := b.String(); got != "abc" {
+		t.Errorf("String() = %q, want %q", got, "abc")
+	}
+
+	b.Write([]byte("defghijklmnop"))
+	got := b.String()
+	if !strings.HasPrefix(got, "abcde\n") || !strings.HasSuffix(got, "\nlmnop") {
+		t.Errorf("String() = %q, want head abcde and tail lmnop", got)
+	}
+	if !strings.Contains(got, "[truncated 6 bytes]") {
+		t.Errorf("String() = %q, want truncation marker for 6 bytes", got)
+	}
+}
+
+func TestTrimLogs(t *testing.T) {
+	d := &database.Model{}
+	for i := 0; i < 4; i++ {
+		d.AddAttempt(&database.Attempt{Logs: "logs"})
+	}
+	d.TrimLogs(2)
+
+	for i, a := range d.Attempts {
+		want := i >= 2
+		if (a.Logs != "") != want {
+			t.Errorf("attempt %d logs = %q, kept want %t", i, a.Logs, want)
+		}
+	}
+}
@@ -2,9 +2,12 @@ package minion
 
 import (
 	"context"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/robfig/cron/v3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.uber.org/zap"
 
 	"github.com/dashotv/fae"
@@ -13,8 +16,11 @@ import (
 
 type Minion struct {
 	Client string
-	Config *Config
-	Log    *zap.SugaredLogger
+	// Instance identifies this process among the replicas of a client,
+	// it is recorded as the owner of the jobs it claims.
+	Instance string
+	Config   *Config
+	Log      *zap.SugaredLogger
 
 	queues        map[string]*Queue
 	notifications chan *Notification
@@ -24,26 +30,52 @@ type Minion struct {
 	subs          []func(*Notification)
 	listening     bool
 
+	waiters   map[string][]chan struct{}
+	discarded map[string]bool // waited on jobs discarded by this process
+	waitersMu sync.Mutex
+
 	statsEntry cron.EntryID
 	statsSubs  []func(Stats)
 
-	cancel context.CancelFunc
+	// running tracks the jobs being run, by id, for Stop
+	running   map[string]bool
+	runningMu sync.Mutex
+
+	producers     sync.WaitGroup
+	runners       sync.WaitGroup
+	stopProducers context.CancelFunc
+	quit          chan struct{}
+	runCtx        context.Context // used by runners started after Start
+	cancel        context.CancelCauseFunc
+	cancelMu      sync.Mutex // guards cancel, Stop may be called concurrently
 }
 
+// errShutdown is the cause of the context of jobs that were still
+// running when Stop's deadline passed.
+var errShutdown = fae.New("minion shutdown")
+
 type Config struct {
 	Concurrency     int
 	BufferSize      int
 	PollingInterval int
 	Timeout         int
+	MaxAttempts     int
+	JobLogSize      int // bytes of logs kept per attempt
+	JobLogAttempts  int // latest attempts that keep their logs
+
+	HeartbeatInterval int // seconds between heartbeats of running jobs
+	HeartbeatTimeout  int // seconds without a heartbeat before a job is rescued
+	LeaderLease       int // seconds the cron leader's lease lasts without renewal
 
 	Router bool
 	Port   int
 
 	Logger *zap.SugaredLogger
 
-	Database    string
-	Collection  string
-	DatabaseURI string
+	Database       string
+	Collection     string
+	DeadCollection string
+	DatabaseURI    string
 
 	RetryCanceled       bool
 	ShutdownWaitSeconds int
@@ -51,7 +83,7 @@ type Config struct {
 }
 
 func New(client string, cfg *Config) (*Minion, error) {
-	db, err := database.New(cfg.DatabaseURI, cfg.Database, cfg.Collection)
+	db, err := database.New(cfg.DatabaseURI, cfg.Database, cfg.Collection, cfg.DeadCollection)
 	if err != nil {
 		return nil, fae.Errorf("creating database: %w", err)
 	}
@@ -68,17 +100,36 @@ func New(client string, cfg *Config) (*Minion, error) {
 	if cfg.Timeout == 0 {
 		cfg.Timeout = 600 // 10 minutes
 	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.JobLogSize == 0 {
+		cfg.JobLogSize = 64 * 1024
+	}
+	if cfg.JobLogAttempts == 0 {
+		cfg.JobLogAttempts = 5
+	}
+	if cfg.HeartbeatInterval == 0 {
+		cfg.HeartbeatInterval = 10
+	}
+	if cfg.HeartbeatTimeout == 0 {
+		cfg.HeartbeatTimeout = 60
+	}
+	if cfg.LeaderLease == 0 {
+		cfg.LeaderLease = 30
+	}
 	if cfg.ShutdownWaitSeconds == 0 {
 		cfg.ShutdownWaitSeconds = 5
 	}
 
 	queues := map[string]*Queue{
-		"default":  {"default", cfg.Concurrency, cfg.BufferSize, cfg.PollingInterval, make(chan string, cfg.BufferSize)},
-		"schedule": {"schedule", cfg.Concurrency, cfg.BufferSize, 1, make(chan string, cfg.BufferSize)},
+		"default":  newQueue("default", cfg.Concurrency, cfg.BufferSize, cfg.PollingInterval),
+		"schedule": newQueue("schedule", cfg.Concurrency, cfg.BufferSize, 1),
 	}
 
-	return &Minion{
+	m := &Minion{
 		Client:        client,
+		Instance:      primitive.NewObjectID().Hex(),
 		Config:        cfg,
 		Log:           cfg.Logger,
 		db:            db,
@@ -87,20 +138,31 @@ func New(client string, cfg *Config) (*Minion, error) {
 		cron:          cron.New(cron.WithSeconds()),
 		workers:       make(map[string]registration),
 		subs:          []func(*Notification){},
+		waiters:       make(map[string][]chan struct{}),
+		discarded:     make(map[string]bool),
+		running:       make(map[string]bool),
+		quit:          make(chan struct{}),
 		cancel:        nil,
-	}, nil
+	}
+	m.Subscribe(m.wake)
+
+	return m, nil
 }
 
 func (m *Minion) Start(ctx context.Context) error {
-	ctx, cancel := context.WithCancel(ctx)
+	ctx, cancel := context.WithCancelCause(ctx)
+	m.cancelMu.Lock()
 	m.cancel = cancel
+	m.cancelMu.Unlock()
+	pctx, stopProducers := context.WithCancel(ctx)
+	m.stopProducers = stopProducers
 	// m.Log.Infof("starting minion (concurrency=%d/%d)...", m.Concurrency, m.Concurrency*m.Concurrency)
 	if m.Config.Debug {
 		m.Subscribe(m.debug)
 	}
 
-	if err := m.db.UpdateAbandonedJobs(ctx, m.Client); err != nil {
-		return fae.Errorf("updating abandoned jobs: %w", err)
+	if err := m.rescue(ctx); err != nil {
+		return fae.Errorf("rescuing abandoned jobs: %w", err)
 	}
 
 	if m.Config.RetryCanceled {
@@ -113,23 +175,20 @@ func (m *Minion) Start(ctx context.Context) error {
 		}
 	}
 
+	m.runCtx = ctx
 	for _, queue := range m.queues {
-		for w := 0; w < queue.Concurrency; w++ {
-			runner := &Runner{
-				ID:     w,
-				Minion: m,
-				Queue:  queue,
-			}
-			go runner.Run(ctx)
+		if err := m.db.SetQueueConfigured(ctx, m.Client, queue.Name, queue.Concurrency); err != nil {
+			return fae.Errorf("recording queue: %w", err)
 		}
+		m.resize(queue, queue.Concurrency)
 
 		p := &Producer{Minion: m, Queue: queue}
-		p.Run(ctx)
+		p.Run(pctx)
 	}
 
-	go func() {
-		m.cron.Start()
-	}()
+	go m.lead(ctx)
+
+	go m.reap(ctx)
 
 	go func() {
 		if len(m.subs) > 0 {
@@ -155,9 +214,76 @@ func (m *Minion) Start(ctx context.Context) error {
 	return nil
 }
 
-func (m *Minion) Stop() {
-	if m.cancel != nil {
-		m.cancel()
-		<-time.After(time.Duration(m.Config.ShutdownWaitSeconds) * time.Second)
+// Stop shuts down gracefully. The producers are stopped, jobs still
+// waiting in the queue buffers are released back to pending, and running
+// jobs are given until the context's deadline to finish (or
+// ShutdownWaitSeconds, if the context has none). Jobs still running after
+// that are cancelled and released back to pending, without counting the
+// interrupted attempt, and are listed in the returned error.
+func (m *Minion) Stop(ctx context.Context) error {
+	m.cancelMu.Lock()
+	cancel := m.cancel
+	m.cancel = nil
+	m.cancelMu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	defer cancel(errShutdown)
+
+	if _, ok := ctx.Deadline(); !ok {
+		var timeout context.CancelFunc
+		ctx, timeout = context.WithTimeout(ctx, time.Duration(m.Config.ShutdownWaitSeconds)*time.Second)
+		defer timeout()
+	}
+
+	m.stopProducers()
+	m.producers.Wait()
+	close(m.quit)
+
+	queued := []string{}
+	for _, q := range m.queues {
+		queued = append(queued, drain(q.channel)...)
+	}
+	if err := m.db.ReleaseJobs(context.Background(), queued); err != nil {
+		m.Log.Errorf("releasing queued jobs: %s", err)
+	}
+	m.releaseSlots(queued...)
+
+	done := make(chan struct{})
+	go func() {
+		m.runners.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	m.runningMu.Lock()
+	running := make([]string, 0, len(m.running))
+	for id := range m.running {
+		running = append(running, id)
+	}
+	m.runningMu.Unlock()
+
+	// runners don't save jobs cancelled by shutdown, they are released here
+	cancel(errShutdown)
+	if err := m.db.ReleaseJobs(context.Background(), running); err != nil {
+		m.Log.Errorf("releasing running jobs: %s", err)
+	}
+	m.releaseSlots(running...)
+	return fae.Errorf("jobs still running: %s", strings.Join(running, ", "))
+}
+
+// setRunning records whether the job is being run.
+func (m *Minion) setRunning(jobID string, running bool) {
+	m.runningMu.Lock()
+	defer m.runningMu.Unlock()
+	if running {
+		m.running[jobID] = true
+		return
 	}
+	delete(m.running, jobID)
 }
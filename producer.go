@@ -3,8 +3,6 @@ package minion
 import (
 	"context"
 	"time"
-
-	"github.com/dashotv/minion/database"
 )
 
 type Producer struct {
@@ -17,44 +15,171 @@ func (p *Producer) Run(ctx context.Context) {
 	p.ch = make(chan string, 1)
 	p.Minion.Subscribe(func(n *Notification) {
 		if n.Event == "job:created" && n.Kind == p.Queue.Name {
-			p.ch <- n.JobID
+			select {
+			case p.ch <- n.JobID:
+			default:
+			}
 		}
 	})
+	p.Minion.producers.Add(1)
 	go p.listen(ctx)
 }
 
 func (p *Producer) listen(ctx context.Context) {
+	defer p.Minion.producers.Done()
 	for {
 		select {
 		case <-p.ch:
 		case <-time.After(time.Duration(p.Queue.Interval) * time.Second):
 			p.handle()
 		case <-ctx.Done():
-			close(p.ch)
 			return
 		}
 	}
 }
 
 func (p *Producer) handle() {
+	state, err := p.Minion.db.GetQueueState(context.Background(), p.Minion.Client, p.Queue.Name)
+	if err != nil {
+		p.Minion.Log.Errorf("checking queue state: %s", err)
+		return
+	}
+	concurrency := p.Queue.Concurrency
+	if state.Concurrency > 0 {
+		concurrency = state.Concurrency
+	}
+	p.Minion.resize(p.Queue, concurrency)
+	if state.Paused {
+		return
+	}
+
 	if p.Queue.Full() {
 		return
 	}
 
-	i := p.Queue.Remaining()
-	list, err := p.Minion.db.Jobs.Query().Where("client", p.Minion.Client).Where("queue", p.Queue.Name).Where("status", database.StatusPending).Asc("created_at").Limit(i).Run()
+	if err := p.promoteWaiting(); err != nil {
+		p.Minion.Log.Errorf("promoting waiting jobs: %s", err)
+	}
+	if _, err := p.Minion.db.PromoteScheduledJobs(context.Background(), p.Minion.Client, p.Queue.Name); err != nil {
+		p.Minion.Log.Errorf("promoting scheduled jobs: %s", err)
+	}
+
+	ctx := context.Background()
+	exclude, err := p.heldKinds(ctx)
 	if err != nil {
-		p.Minion.Log.Errorf("querying pending jobs: %s", err)
+		p.Minion.Log.Errorf("checking kind limits: %s", err)
+		return
 	}
 
-	for _, j := range list {
-		j.Status = string(database.StatusQueued)
-		err = p.Minion.db.Jobs.Save(j)
+	l := p.Queue.limiter
+	for i := p.Queue.Remaining(); i > 0; i-- {
+		if l != nil {
+			ok, err := l.take(ctx)
+			if err != nil {
+				p.Minion.Log.Errorf("rate limit: %s", err)
+				return
+			}
+			if !ok {
+				return
+			}
+		}
+
+		j, err := p.Minion.db.ClaimJob(ctx, p.Minion.Client, p.Queue.Name, p.Minion.Instance, exclude)
 		if err != nil {
-			p.Minion.Log.Errorf("updating job: %s", err)
+			p.refund(ctx)
+			p.Minion.Log.Errorf("claiming job: %s", err)
+			return
+		}
+		if j == nil {
+			p.refund(ctx)
+			return
+		}
+
+		ok, err := p.takeKind(ctx, j.Kind, j.ID.Hex())
+		if err != nil || !ok {
+			// the kind is at its limit, another process got the last
+			// token or slot
+			if err != nil {
+				p.Minion.Log.Errorf("checking kind limits: %s", err)
+			}
+			if err := p.Minion.db.ReleaseJobs(ctx, []string{j.ID.Hex()}); err != nil {
+				p.Minion.Log.Errorf("releasing job: %s", err)
+			}
+			p.refund(ctx)
+			exclude = append(exclude, j.Kind)
+			continue
 		}
 
 		p.Minion.notify("job:queued", j.ID.Hex(), j.Kind)
 		p.Queue.channel <- j.ID.Hex()
 	}
 }
+
+// refund returns the rate limit token taken for a job that wasn't claimed.
+func (p *Producer) refund(ctx context.Context) {
+	if p.Queue.limiter != nil {
+		p.Queue.limiter.refund(ctx)
+	}
+}
+
+// heldKinds returns the kinds registered to the producer's queue that
+// can't be claimed right now, because all of their concurrency slots are
+// held or their rate limit has no tokens.
+func (p *Producer) heldKinds(ctx context.Context) ([]string, error) {
+	names := []string{}
+	held := []string{}
+	for kind, w := range p.Minion.workers {
+		if w.queue != p.Queue.Name {
+			continue
+		}
+		if w.concurrency > 0 {
+			names = append(names, p.Minion.slotName(kind))
+		}
+		if w.limiter != nil {
+			ok, err := w.limiter.ready(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				held = append(held, kind)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return held, nil
+	}
+
+	slots, err := p.Minion.db.SlotsHeld(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	for kind, w := range p.Minion.workers {
+		if w.concurrency > 0 && w.queue == p.Queue.Name && slots[p.Minion.slotName(kind)] >= w.concurrency {
+			held = append(held, kind)
+		}
+	}
+	return held, nil
+}
+
+// takeKind takes the kind's rate limit token and concurrency slot for a
+// claimed job, returns false if either isn't available. Kinds without
+// limits are always available.
+func (p *Producer) takeKind(ctx context.Context, kind, jobID string) (bool, error) {
+	w, ok := p.Minion.workers[kind]
+	if !ok {
+		return true, nil
+	}
+
+	if w.limiter != nil {
+		ok, err := w.limiter.take(ctx)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	ok, err := p.acquireSlot(ctx, kind, jobID)
+	if (err != nil || !ok) && w.limiter != nil {
+		w.limiter.refund(ctx)
+	}
+	return ok, err
+}
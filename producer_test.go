@@ -0,0 +1,135 @@
+package minion
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type countPayload struct {
+	N int `json:"n"`
+}
+
+func (p *countPayload) Kind() string { return "count" }
+
+type countWorker struct {
+	WorkerDefaults[*countPayload]
+	mu   *sync.Mutex
+	runs map[string]int
+}
+
+func (w *countWorker) Work(ctx context.Context, job *Job[*countPayload]) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.runs[job.ID.Hex()]++
+	return nil
+}
+
+// testMongo returns the uri of the test database, the test is skipped if
+// it is not available.
+func testMongo(t *testing.T) string {
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		uri = "mongodb://localhost:27017"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetServerSelectionTimeout(2*time.Second))
+	if err != nil {
+		t.Skipf("mongo not available: %s", err)
+	}
+	defer client.Disconnect(context.Background())
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Skipf("mongo not available: %s", err)
+	}
+	return uri
+}
+
+func TestProducersClaimOnce(t *testing.T) {
+	uri := testMongo(t)
+	collection := "jobs_test_" + primitive.NewObjectID().Hex()
+	total := 200
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mu := &sync.Mutex{}
+	runs := map[string]int{}
+	minions := []*Minion{}
+	for i := 0; i < 4; i++ {
+		m, err := New("test", &Config{
+			Logger:      zap.NewNop().Sugar(),
+			DatabaseURI: uri,
+			Database:    "minion_test",
+			Collection:  collection,
+		})
+		if err != nil {
+			t.Fatalf("creating minion: %s", err)
+		}
+		if err := Register[*countPayload](m, &countWorker{mu: mu, runs: runs}); err != nil {
+			t.Fatalf("registering worker: %s", err)
+		}
+		minions = append(minions, m)
+	}
+	defer func() {
+		for _, m := range minions {
+			_ = m.Stop(context.Background())
+		}
+		db := minions[0].db
+		_ = db.Jobs.Collection.Drop(context.Background())
+		_ = db.Dead.Collection.Drop(context.Background())
+		_ = db.Batches.Collection.Drop(context.Background())
+		_ = db.Queues.Collection.Drop(context.Background())
+		_ = db.Locks.Drop(context.Background())
+		_ = db.Limits.Drop(context.Background())
+		_ = db.Slots.Drop(context.Background())
+	}()
+
+	payloads := make([]Payload, total)
+	for i := range payloads {
+		payloads[i] = &countPayload{N: i}
+	}
+	ids, err := minions[0].EnqueueMany(payloads)
+	if err != nil {
+		t.Fatalf("enqueueing jobs: %s", err)
+	}
+
+	for _, m := range minions {
+		if err := m.Start(ctx); err != nil {
+			t.Fatalf("starting minion: %s", err)
+		}
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		mu.Lock()
+		n := len(runs)
+		mu.Unlock()
+		if n == total {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ran %d of %d jobs", n, total)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	// let any duplicate claims run
+	time.Sleep(2 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range ids {
+		if runs[id] != 1 {
+			t.Errorf("job %s ran %d times", id, runs[id])
+		}
+	}
+	t.Logf("ran %d jobs with %d producers", len(runs), len(minions))
+}
@@ -0,0 +1,36 @@
+package minion
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/dashotv/fae"
+	"github.com/dashotv/minion/database"
+)
+
+// progressInterval throttles how often progress is written to the
+// database and notified.
+const progressInterval = time.Second
+
+// Progress reports the job's progress. It is always kept on the job, and
+// is saved when the attempt finishes, but it is only written to the
+// database and notified at most once per second, or when it reaches 100.
+func (j *Job[T]) Progress(ctx context.Context, percent int, message string) error {
+	now := time.Now()
+	j.Model.Progress = &database.Progress{Percent: percent, Message: message, UpdatedAt: now}
+
+	if j.minion == nil || (percent < 100 && now.Sub(j.progressAt) < progressInterval) {
+		return nil
+	}
+	j.progressAt = now
+
+	_, err := j.minion.db.Jobs.Collection.UpdateOne(ctx, bson.M{"_id": j.ID}, bson.M{"$set": bson.M{"progress": j.Model.Progress}})
+	if err != nil {
+		return fae.Wrap(err, "updating job progress")
+	}
+
+	j.minion.notify("job:progress", j.ID.Hex(), j.Kind)
+	return nil
+}
@@ -1,11 +1,45 @@
 package minion
 
+import (
+	"context"
+	"sync"
+
+	"github.com/dashotv/fae"
+)
+
 type Queue struct {
 	Name        string
 	Concurrency int
 	BufferSize  int
 	Interval    int
 	channel     chan string
+
+	// runners has the stop channel of each running runner, its length is
+	// the queue's current concurrency
+	runners   []chan struct{}
+	runnersMu sync.Mutex
+
+	limiter limiter
+}
+
+// QueueOpts configures a queue, zero values use the config defaults.
+type QueueOpts struct {
+	Concurrency int
+	BufferSize  int
+	Interval    int
+
+	// RateLimit limits how fast jobs are claimed from the queue.
+	RateLimit *RateLimit
+}
+
+func newQueue(name string, concurrency, buffersize, interval int) *Queue {
+	return &Queue{
+		Name:        name,
+		Concurrency: concurrency,
+		BufferSize:  buffersize,
+		Interval:    interval,
+		channel:     make(chan string, buffersize),
+	}
 }
 
 func (q *Queue) Full() bool {
@@ -18,15 +52,101 @@ func (q *Queue) Remaining() int {
 
 // Queue adds a new queue to Minion.
 func (m *Minion) Queue(name string, concurrency, buffersize, interval int) {
-	if concurrency == 0 {
-		concurrency = m.Config.Concurrency
+	// without a rate limit there's nothing to fail
+	_ = m.QueueWithOptions(name, QueueOpts{Concurrency: concurrency, BufferSize: buffersize, Interval: interval})
+}
+
+// QueueWithOptions adds a new queue to Minion.
+func (m *Minion) QueueWithOptions(name string, opts QueueOpts) error {
+	if opts.Concurrency == 0 {
+		opts.Concurrency = m.Config.Concurrency
 	}
-	if buffersize == 0 {
-		buffersize = m.Config.BufferSize
+	if opts.BufferSize == 0 {
+		opts.BufferSize = m.Config.BufferSize
 	}
-	if interval == 0 {
-		interval = m.Config.PollingInterval
+	if opts.Interval == 0 {
+		opts.Interval = m.Config.PollingInterval
 	}
 
-	m.queues[name] = &Queue{name, concurrency, buffersize, interval, make(chan string, buffersize)}
+	l, err := m.newLimiter("queue:"+name, opts.RateLimit)
+	if err != nil {
+		return fae.Wrap(err, "creating queue")
+	}
+
+	q := newQueue(name, opts.Concurrency, opts.BufferSize, opts.Interval)
+	q.limiter = l
+	m.queues[name] = q
+	return nil
+}
+
+// PauseQueue pauses the queue for every process of the client, until it
+// is resumed. Jobs are not claimed from a paused queue, jobs already
+// queued or running are not affected.
+func (m *Minion) PauseQueue(name string) error {
+	if err := m.db.SetQueuePaused(context.Background(), m.Client, name, true); err != nil {
+		return fae.Wrap(err, "pausing queue")
+	}
+	m.notify("queue:pause", "-", name)
+	return nil
+}
+
+// ResumeQueue resumes a paused queue.
+func (m *Minion) ResumeQueue(name string) error {
+	if err := m.db.SetQueuePaused(context.Background(), m.Client, name, false); err != nil {
+		return fae.Wrap(err, "resuming queue")
+	}
+	m.notify("queue:resume", "-", name)
+	return nil
+}
+
+// SetConcurrency sets the number of runners of the queue for every
+// process of the client, a concurrency of 0 resets it to the queue's
+// configured concurrency. The runner pool is resized while running, when
+// it shrinks, busy runners finish their current job before they exit.
+func (m *Minion) SetConcurrency(name string, n int) error {
+	q, ok := m.queues[name]
+	if !ok {
+		return fae.Errorf("queue not found: %s", name)
+	}
+	if n < 0 {
+		return fae.Errorf("invalid concurrency: %d", n)
+	}
+
+	if err := m.db.SetQueueConcurrency(context.Background(), m.Client, name, n); err != nil {
+		return fae.Wrap(err, "setting queue concurrency")
+	}
+	if n == 0 {
+		n = q.Concurrency
+	}
+	m.resize(q, n)
+	return nil
+}
+
+// resize starts or stops runners until the queue has n of them, runners
+// are only started after Start and before Stop.
+func (m *Minion) resize(q *Queue, n int) {
+	q.runnersMu.Lock()
+	defer q.runnersMu.Unlock()
+
+	for len(q.runners) > n {
+		last := len(q.runners) - 1
+		close(q.runners[last])
+		q.runners = q.runners[:last]
+	}
+
+	if m.runCtx == nil || channelClosed(m.quit) {
+		return
+	}
+	for len(q.runners) < n {
+		stop := make(chan struct{})
+		runner := &Runner{
+			ID:     len(q.runners),
+			Minion: m,
+			Queue:  q,
+			stop:   stop,
+		}
+		q.runners = append(q.runners, stop)
+		m.runners.Add(1)
+		go runner.Run(m.runCtx)
+	}
 }
@@ -0,0 +1,127 @@
+package minion
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dashotv/fae"
+)
+
+// RateLimit is a token bucket limit of Rate jobs every Per, with bursts
+// of up to Burst jobs. Shared limits are coordinated through the database
+// across all of the client's processes, otherwise each process has its
+// own bucket.
+type RateLimit struct {
+	Rate   int
+	Per    time.Duration // defaults to a second
+	Burst  int           // defaults to 1
+	Shared bool
+}
+
+// limiter holds jobs back until the rate limit allows them.
+type limiter interface {
+	// take takes a token, if one is available
+	take(ctx context.Context) (bool, error)
+	// refund returns a token that wasn't used
+	refund(ctx context.Context)
+	// ready returns true if a token is available, without taking it
+	ready(ctx context.Context) (bool, error)
+}
+
+// newLimiter returns the limiter for the rate limit, name identifies a
+// shared limit's bucket. Returns nil if there is no limit.
+func (m *Minion) newLimiter(name string, rl *RateLimit) (limiter, error) {
+	if rl == nil {
+		return nil, nil
+	}
+	if rl.Rate <= 0 {
+		return nil, fae.Errorf("invalid rate limit: %d", rl.Rate)
+	}
+
+	per := rl.Per
+	if per == 0 {
+		per = time.Second
+	}
+	burst := rl.Burst
+	if burst == 0 {
+		burst = 1
+	}
+	interval := per / time.Duration(rl.Rate)
+
+	if rl.Shared {
+		return &sharedLimiter{minion: m, name: m.Client + ":" + name, interval: interval, burst: burst}, nil
+	}
+	return &localLimiter{interval: interval, burst: float64(burst), tokens: float64(burst), last: time.Now()}, nil
+}
+
+// localLimiter is a token bucket in memory.
+type localLimiter struct {
+	interval time.Duration
+	burst    float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens gained since the last refill, must be called
+// with the lock held.
+func (l *localLimiter) refill() {
+	now := time.Now()
+	l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+func (l *localLimiter) take(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill()
+	if l.tokens < 1 {
+		return false, nil
+	}
+	l.tokens--
+	return true, nil
+}
+
+func (l *localLimiter) refund(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokens+1 <= l.burst {
+		l.tokens++
+	}
+}
+
+func (l *localLimiter) ready(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill()
+	return l.tokens >= 1, nil
+}
+
+// sharedLimiter is a token bucket in the database.
+type sharedLimiter struct {
+	minion   *Minion
+	name     string
+	interval time.Duration
+	burst    int
+}
+
+func (l *sharedLimiter) take(ctx context.Context) (bool, error) {
+	return l.minion.db.TakeToken(ctx, l.name, l.interval, l.burst)
+}
+
+func (l *sharedLimiter) refund(ctx context.Context) {
+	if err := l.minion.db.ReturnToken(ctx, l.name, l.burst); err != nil {
+		l.minion.Log.Warnf("rate limit: %s", err)
+	}
+}
+
+func (l *sharedLimiter) ready(ctx context.Context) (bool, error) {
+	return l.minion.db.TokenAvailable(ctx, l.name, l.interval)
+}
@@ -0,0 +1,41 @@
+package minion
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocalLimiter(t *testing.T) {
+	m := &Minion{Client: "test", Config: &Config{}}
+	l, err := m.newLimiter("test", &RateLimit{Rate: 10, Per: time.Second, Burst: 2})
+	if err != nil {
+		t.Fatalf("creating limiter: %s", err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.take(ctx); !ok {
+			t.Fatalf("take %d: want token within burst", i)
+		}
+	}
+	if ok, _ := l.take(ctx); ok {
+		t.Fatalf("take: want no token after burst")
+	}
+
+	l.refund(ctx)
+	if ok, _ := l.take(ctx); !ok {
+		t.Fatalf("take: want refunded token")
+	}
+
+	if ok, _ := l.ready(ctx); ok {
+		t.Fatalf("ready: want no token before refill")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if ok, _ := l.ready(ctx); !ok {
+		t.Fatalf("ready: want token after refill")
+	}
+	if ok, _ := l.take(ctx); !ok {
+		t.Fatalf("take: want token after refill")
+	}
+}
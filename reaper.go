@@ -0,0 +1,168 @@
+package minion
+
+import (
+	"context"
+	"time"
+
+	"github.com/dashotv/minion/database"
+)
+
+// staleTime returns the time before which a running job's heartbeat is
+// considered lost.
+func (m *Minion) staleTime() time.Time {
+	return time.Now().Add(-time.Duration(m.Config.HeartbeatTimeout) * time.Second)
+}
+
+// heartbeat updates the job's heartbeat every HeartbeatInterval until
+// the context is done. If the job's cancellation has been requested, the
+// job's context is cancelled with errCancelRequested.
+func (m *Minion) heartbeat(ctx context.Context, d *database.Model, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(time.Duration(m.Config.HeartbeatInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			requested, err := m.db.Heartbeat(ctx, d.ID)
+			if err != nil {
+				m.Log.Warnf("heartbeat: %s: %s", d.ID.Hex(), err)
+				continue
+			}
+			if requested {
+				cancel(errCancelRequested)
+				return
+			}
+		}
+	}
+}
+
+// reap keeps the heartbeat of this instance's queued jobs and the slots
+// they hold, and rescues the client's queued and running jobs that have
+// lost their heartbeat, the process that claimed them has most likely
+// died. It also finishes batches whose callbacks failed to be enqueued.
+// It runs every HeartbeatInterval until the context is done.
+func (m *Minion) reap(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(m.Config.HeartbeatInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.db.HeartbeatQueued(ctx, m.Instance); err != nil {
+				m.Log.Warnf("heartbeat: queued: %s", err)
+			}
+			if m.limited() {
+				if err := m.db.RenewSlots(ctx, m.Instance, m.slotTTL()); err != nil {
+					m.Log.Warnf("heartbeat: slots: %s", err)
+				}
+			}
+			if err := m.rescue(ctx); err != nil {
+				m.Log.Errorf("reaper: %s", err)
+			}
+			if err := m.finishBatches(ctx); err != nil {
+				m.Log.Errorf("reaper: batches: %s", err)
+			}
+		}
+	}
+}
+
+// rescue releases the client's stale queued jobs back to pending, and
+// reaps its stale running jobs. It is also run on Start, for the jobs of
+// a process that didn't stop cleanly.
+func (m *Minion) rescue(ctx context.Context) error {
+	if _, err := m.db.ReleaseStaleQueued(ctx, m.Client, m.staleTime()); err != nil {
+		return err
+	}
+	for {
+		n, err := m.reapStale(ctx)
+		if err != nil {
+			return err
+		}
+		if n < staleBatch {
+			return nil
+		}
+	}
+}
+
+// staleBatch is the number of stale jobs found at a time, matches the
+// limit of StaleJobs.
+const staleBatch = 100
+
+// reapStale fails the current attempt of each stale job, and either
+// retries it with backoff or moves it to the dead-letter collection if it
+// has no attempts remaining. Returns the number of stale jobs found.
+func (m *Minion) reapStale(ctx context.Context) (int, error) {
+	stale := m.staleTime()
+	list, err := m.db.StaleJobs(m.Client, stale)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range list {
+		attempts := d.AttemptCount()
+		status := database.StatusPending
+		retryAt := time.Now().Add(backoff(attempts))
+		if attempts >= m.reapMaxAttempts(d) {
+			status = database.StatusFailed
+			retryAt = time.Time{}
+		}
+
+		ok, err := m.db.RescueJob(ctx, d, stale, status, retryAt)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			// the job got a heartbeat or finished since it was found
+			continue
+		}
+
+		jobID := d.ID.Hex()
+		m.Log.Warnf("reaper: heartbeat lost: %s %s", d.Kind, jobID)
+		if status == database.StatusPending {
+			m.notify("job:retry", jobID, d.Kind)
+			continue
+		}
+
+		if err := m.db.Jobs.Find(jobID, d); err != nil {
+			return 0, err
+		}
+		m.notify("job:dead", jobID, d.Kind)
+		if err := m.db.Kill(ctx, d); err != nil {
+			return 0, err
+		}
+		m.recordBatch(d)
+	}
+	return len(list), nil
+}
+
+// reapMaxAttempts returns the maximum number of attempts for a stale job,
+// the worker is only consulted if its kind is registered here and the
+// job's args can be unmarshaled. The worker's MaxAttempts runs outside of
+// a runner, so a panic falls back to the job's or config's value.
+func (m *Minion) reapMaxAttempts(d *database.Model) (n int) {
+	fallback := m.Config.MaxAttempts
+	if d.MaxAttempts > 0 {
+		fallback = d.MaxAttempts
+	}
+	defer func() {
+		if recovery := recover(); recovery != nil {
+			m.Log.Errorf("reaper: max attempts: %s: panic: %v", d.Kind, recovery)
+			n = fallback
+		}
+	}()
+
+	w, ok := m.workers[d.Kind]
+	if !ok {
+		return fallback
+	}
+	job := w.factory.Create(m, d)
+	if err := job.Unmarshal(); err != nil {
+		return fallback
+	}
+	r := &Runner{Minion: m}
+	return r.maxAttempts(d, job)
+}
@@ -8,6 +8,21 @@ type registration struct {
 	queue       string
 	concurrency int
 	bufferSize  int
+	limiter     limiter
+}
+
+// RegisterOpts configures a worker's registration.
+type RegisterOpts struct {
+	// Queue defaults to "default".
+	Queue string
+
+	// RateLimit limits how fast jobs of the worker's kind are claimed,
+	// jobs are left pending until it allows them.
+	RateLimit *RateLimit
+
+	// MaxConcurrent limits how many jobs of the worker's kind run at once
+	// across all of the client's processes.
+	MaxConcurrent int
 }
 
 func Register[T Payload](m *Minion, worker Worker[T]) error {
@@ -15,17 +30,48 @@ func Register[T Payload](m *Minion, worker Worker[T]) error {
 }
 
 func RegisterWithQueue[T Payload](m *Minion, worker Worker[T], queue string) error {
+	return RegisterWithOptions(m, worker, RegisterOpts{Queue: queue})
+}
+
+// RegisterWithOptions registers a worker with the given options.
+func RegisterWithOptions[T Payload](m *Minion, worker Worker[T], opts RegisterOpts) error {
+	policy, _ := worker.(RetryPolicy[T])
+	return register(m, &workerFactory[T]{worker: worker, policy: policy}, opts)
+}
+
+// RegisterWithResult registers a worker that returns a result, with the
+// given options.
+func RegisterWithResult[T Payload, R any](m *Minion, worker WorkerWithResult[T, R], opts RegisterOpts) error {
+	policy, _ := worker.(RetryPolicy[T])
+	return register(m, &workerFactory[T]{worker: &resultWorker[T, R]{worker: worker}, policy: policy}, opts)
+}
+
+func register[T Payload](m *Minion, f *workerFactory[T], opts RegisterOpts) error {
 	var args T
 
 	kind := args.Kind()
 	if _, ok := m.workers[kind]; ok {
 		return fae.Errorf("worker already registered for kind: %s", kind)
 	}
+	if opts.Queue == "" {
+		opts.Queue = "default"
+	}
+
+	if opts.MaxConcurrent < 0 {
+		return fae.Errorf("invalid max concurrent: %d", opts.MaxConcurrent)
+	}
+
+	l, err := m.newLimiter("kind:"+kind, opts.RateLimit)
+	if err != nil {
+		return fae.Wrap(err, "registering worker")
+	}
 
 	m.workers[kind] = registration{
-		args:    args,
-		factory: &workerFactory[T]{worker: worker},
-		queue:   queue,
+		args:        args,
+		factory:     f,
+		queue:       opts.Queue,
+		concurrency: opts.MaxConcurrent,
+		limiter:     l,
 	}
 
 	return nil
@@ -0,0 +1,26 @@
+package minion
+
+import (
+	"encoding/json"
+
+	"github.com/dashotv/fae"
+	"github.com/dashotv/minion/database"
+)
+
+// Result returns the result stored by a WorkerWithResult for the job.
+func Result[R any](m *Minion, jobID string) (R, error) {
+	var result R
+
+	d := &database.Model{}
+	if err := m.db.Jobs.Find(jobID, d); err != nil {
+		return result, fae.Wrapf(err, "finding job: %s", jobID)
+	}
+	if d.Result == "" {
+		return result, fae.Errorf("job has no result: %s", jobID)
+	}
+
+	if err := json.Unmarshal([]byte(d.Result), &result); err != nil {
+		return result, fae.Wrap(err, "unmarshaling job result")
+	}
+	return result, nil
+}
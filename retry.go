@@ -0,0 +1,74 @@
+package minion
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/dashotv/minion/database"
+)
+
+const (
+	retryBaseDelay = 15 * time.Second
+	retryMaxDelay  = 6 * time.Hour
+)
+
+// backoff returns the delay before the next retry of a job that has
+// failed the given number of attempts. The delay grows exponentially
+// from retryBaseDelay, is capped at retryMaxDelay, and has up to 25%
+// jitter added so that jobs that failed together don't retry together.
+func backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	d := float64(retryBaseDelay) * math.Pow(2, float64(attempt-1))
+	if d > float64(retryMaxDelay) {
+		d = float64(retryMaxDelay)
+	}
+
+	jitter := rand.Float64() * d / 4
+	return time.Duration(d + jitter)
+}
+
+// maxAttempts returns the maximum number of attempts for the job, the
+// job's value takes precedence over the worker's, and both over the
+// config default.
+func (r *Runner) maxAttempts(d *database.Model, job wrapped) int {
+	if d.MaxAttempts > 0 {
+		return d.MaxAttempts
+	}
+	if n := job.MaxAttempts(); n > 0 {
+		return n
+	}
+	return r.Minion.Config.MaxAttempts
+}
+
+// retry sets the job back to pending with a retry time, if it has
+// attempts remaining and the worker's RetryPolicy (if any) allows it.
+// The retry time and the reason for the decision are recorded on the
+// attempt. Returns true if the job will be retried.
+func (r *Runner) retry(d *database.Model, job wrapped, attempt *database.Attempt, err error) bool {
+	attempts := d.AttemptCount()
+	if attempts >= r.maxAttempts(d, job) {
+		attempt.RetryReason = "max attempts reached"
+		return false
+	}
+
+	at, retry, ok := job.NextRetry(attempts, err)
+	switch {
+	case !ok:
+		at = time.Now().Add(backoff(attempts))
+		attempt.RetryReason = "backoff"
+	case !retry:
+		attempt.RetryReason = "retry policy: no retry"
+		return false
+	default:
+		attempt.RetryReason = "retry policy"
+	}
+
+	attempt.RetryAt = at
+	d.Status = string(database.StatusPending)
+	d.RetryAt = at
+	return true
+}
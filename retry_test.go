@@ -0,0 +1,26 @@
+package minion
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		attempt int
+		min     time.Duration
+	}{
+		{0, retryBaseDelay},
+		{1, retryBaseDelay},
+		{2, 2 * retryBaseDelay},
+		{3, 4 * retryBaseDelay},
+		{100, retryMaxDelay},
+	}
+
+	for _, c := range cases {
+		d := backoff(c.attempt)
+		if d < c.min || d > c.min+c.min/4 {
+			t.Errorf("backoff(%d) = %s, want between %s and %s", c.attempt, d, c.min, c.min+c.min/4)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package minion
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"runtime/debug"
 	"time"
@@ -14,23 +15,48 @@ type Runner struct {
 	ID     int
 	Minion *Minion
 	Queue  *Queue
+	stop   chan struct{}
 }
 
+// Run runs jobs from the queue until Stop is called, or the runner is
+// stopped by a smaller concurrency.
 func (r *Runner) Run(ctx context.Context) {
-	for jobID := range r.Queue.channel {
-		err := r.runJob(ctx, jobID)
-		if err != nil {
-			m := err.Error()
-			if len(m) > 100 {
-				m = m[:97] + "..."
+	defer r.Minion.runners.Done()
+
+	for {
+		// check first, select picks randomly when both are ready
+		select {
+		case <-r.Minion.quit:
+			return
+		case <-r.stop:
+			return
+		default:
+		}
+
+		select {
+		case <-r.Minion.quit:
+			return
+		case <-r.stop:
+			return
+		case jobID := <-r.Queue.channel:
+			err := r.runJob(ctx, jobID)
+			if err != nil {
+				m := err.Error()
+				if len(m) > 100 {
+					m = m[:97] + "..."
+				}
+				r.Minion.Log.Errorf("runner: %s", m)
 			}
-			r.Minion.Log.Errorf("runner: %s", m)
 		}
 	}
 }
 
 // runJob runs a job
 func (r *Runner) runJob(ctx context.Context, jobID string) (err error) {
+	r.Minion.setRunning(jobID, true)
+	defer r.Minion.setRunning(jobID, false)
+	defer r.Minion.releaseSlots(jobID)
+
 	r.Minion.notify("job:load", jobID, "-")
 
 	job, d, err := r.loadJob(jobID)
@@ -38,11 +64,27 @@ func (r *Runner) runJob(ctx context.Context, jobID string) (err error) {
 		return fae.Wrap(err, "loading job")
 	}
 
+	if d.CancelRequested {
+		// cancelled while it was queued
+		d.Status = string(database.StatusCancelled)
+		if err := r.Minion.db.Jobs.Save(d); err != nil {
+			return fae.Wrap(err, "cancelling job")
+		}
+		r.Minion.notify("job:cancel", jobID, d.Kind)
+		r.Minion.recordBatch(d)
+		return nil
+	}
+
 	defer func() {
 		if recovery := recover(); recovery != nil {
 			err = fae.Errorf("panic (outside of job work): %v\n%s", recovery, string(debug.Stack()))
 		}
 
+		if errors.Is(err, errSnoozed) {
+			// job:snooze was sent instead
+			err = nil
+			return
+		}
 		if err != nil {
 			r.Minion.notify("job:fail", jobID, d.Kind)
 		} else {
@@ -68,7 +110,7 @@ func (r *Runner) loadJob(jobID string) (wrapped, *database.Model, error) {
 		return nil, d, e
 	}
 
-	job := w.factory.Create(d)
+	job := w.factory.Create(r.Minion, d)
 	err = job.Unmarshal()
 	if err != nil {
 		return nil, d, fae.Wrap(err, "unmarshaling job")
@@ -81,23 +123,75 @@ func (r *Runner) runJobAttempt(ctx context.Context, jobID string, d *database.Mo
 	attempt := &database.Attempt{}
 	attempt.Start()
 	i := d.AddAttempt(attempt)
+	d.HeartbeatAt = time.Now()
 	err := r.Minion.db.Jobs.Save(d)
 	if err != nil {
 		return fae.Wrap(err, "updating job")
 	}
 
+	logs := newLogBuffer(r.Minion.Config.JobLogSize)
+	job.SetLog(r.Minion.attemptLogger(logs, jobID, d.Kind))
+
 	r.Minion.notify("job:start", jobID, d.Kind)
-	err = r.runJobWork(ctx, job)
-	e := fae.Wrap(err, "running job")
+	workCtx, cancelWork := context.WithCancelCause(ctx)
+	hbCtx, hbCancel := context.WithCancel(ctx)
+	go r.Minion.heartbeat(hbCtx, d, cancelWork)
+	werr := r.runJobWork(workCtx, d, job)
+	hbCancel()
+	cancelWork(nil)
+	if werr != nil && context.Cause(ctx) == errShutdown {
+		// interrupted, released by Stop
+		return fae.Wrap(errShutdown, "running job")
+	}
+	if werr != nil && context.Cause(workCtx) == errCancelRequested {
+		werr = JobCancel(errCancelRequested)
+	}
+	e := fae.Wrap(werr, "running job")
 	attempt.Finish(e)
+	attempt.Logs = logs.String()
+	d.TrimLogs(r.Minion.Config.JobLogAttempts)
 	r.Minion.notify("job:finish", jobID, d.Kind)
 
 	d.UpdateAttempt(i, attempt)
+	switch database.Status(attempt.Status) {
+	case database.StatusFailed:
+		if r.retry(d, job, attempt, werr) {
+			r.Minion.notify("job:retry", jobID, d.Kind)
+			break
+		}
+		r.Minion.notify("job:dead", jobID, d.Kind)
+		if err := r.Minion.db.Kill(context.Background(), d); err != nil {
+			return fae.Wrap(err, "killing job")
+		}
+		r.Minion.recordBatch(d)
+		return e
+	case database.StatusCancelled:
+		// cancelled permanently, RetryCanceled doesn't resume it
+		d.CancelRequested = true
+		r.Minion.notify("job:cancel", jobID, d.Kind)
+	case database.StatusDiscarded:
+		r.Minion.notify("job:discard", jobID, d.Kind)
+		r.Minion.discard(jobID)
+		if err := r.Minion.db.Jobs.Delete(d); err != nil {
+			return fae.Wrap(err, "discarding job")
+		}
+		r.Minion.recordBatch(d)
+		return e
+	case database.StatusSnoozed:
+		d.Status = string(database.StatusPending)
+		d.RetryAt = time.Now().Add(snoozeDuration(werr))
+		e = errSnoozed
+		r.Minion.notify("job:snooze", jobID, d.Kind)
+	}
+
 	err = r.Minion.db.Jobs.Save(d)
 	if err != nil {
 		return fae.Wrap(err, "updating job")
 	}
 
+	if database.Status(d.Status).Done() {
+		r.Minion.recordBatch(d)
+	}
 	return e
 }
 
@@ -105,19 +199,14 @@ func (r *Runner) runJobAttempt(ctx context.Context, jobID string, d *database.Mo
 // to be able to handle deferred panics without affecting
 // the job's attempt status
 // we use named return so recover can set the error
-func (r *Runner) runJobWork(ctx context.Context, job wrapped) (err error) {
+func (r *Runner) runJobWork(ctx context.Context, d *database.Model, job wrapped) (err error) {
 	defer func() {
 		if recovery := recover(); recovery != nil {
 			err = fae.Errorf("panic: %v", recovery)
 		}
 	}()
 
-	t := time.Duration(r.Minion.Config.Timeout) * time.Second
-	if job.Timeout() > 0 {
-		t = job.Timeout()
-	}
-
-	timeoutCtx, timeout := context.WithTimeout(ctx, t)
+	timeoutCtx, timeout := context.WithTimeout(ctx, r.timeout(d, job))
 	defer timeout()
 
 	select {
@@ -134,6 +223,18 @@ func (r *Runner) runJobWork(ctx context.Context, job wrapped) (err error) {
 	return err
 }
 
+// timeout returns the timeout for the job, the job's value takes
+// precedence over the worker's, and both over the config default.
+func (r *Runner) timeout(d *database.Model, job wrapped) time.Duration {
+	if d.Timeout > 0 {
+		return time.Duration(d.Timeout) * time.Second
+	}
+	if t := job.Timeout(); t > 0 {
+		return t
+	}
+	return time.Duration(r.Minion.Config.Timeout) * time.Second
+}
+
 // WithTimeout runs a delegate function with a timeout,
 //
 // Example: Wait for a channel
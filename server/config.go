@@ -20,10 +20,12 @@ type Config struct {
 	MongoURI        string `env:"MONGO_URI" default:"mongodb://localhost:27017"`
 	MongoDatabase   string `env:"MONGO_DATABASE" default:"minion_development"`
 	MongoCollection string `env:"MONGO_COLLECTION" default:"jobs"`
+	MongoDead       string `env:"MONGO_DEAD_COLLECTION" default:"jobs_dead"`
 
 	ShutdownWaitSeconds int `env:"SHUTDOWN_WAIT_SECONDS" default:"5"`
 	KeepFinishedJobs    int `env:"KEEP_FINISHED_JOBS" default:"2"` // hours
 	KeepFailedJobs      int `env:"KEEP_FAILED_JOBS" default:"48"`  // hours
+	KeepDeadJobs        int `env:"KEEP_DEAD_JOBS" default:"168"`   // hours
 }
 
 func setupLogger(s *Server) error {
@@ -47,7 +49,7 @@ func setupLogger(s *Server) error {
 }
 
 func setupDatabase(s *Server) error {
-	con, err := database.New(s.Config.MongoURI, s.Config.MongoDatabase, s.Config.MongoCollection)
+	con, err := database.New(s.Config.MongoURI, s.Config.MongoDatabase, s.Config.MongoCollection, s.Config.MongoDead)
 	if err != nil {
 		return fae.Errorf("creating job store: %w", err)
 	}
@@ -15,11 +15,14 @@ import (
 
 func setupJobs(s *Server) error {
 	mcfg := &minion.Config{
-		Logger:      s.Log.Named("minion"),
-		Debug:       s.Config.Debug,
-		DatabaseURI: s.Config.MongoURI,
-		Database:    s.Config.MongoDatabase,
-		Collection:  s.Config.MongoCollection,
+		Logger:         s.Log.Named("minion"),
+		Debug:          s.Config.Debug,
+		DatabaseURI:    s.Config.MongoURI,
+		Database:       s.Config.MongoDatabase,
+		Collection:     s.Config.MongoCollection,
+		DeadCollection: s.Config.MongoDead,
+
+		ShutdownWaitSeconds: s.Config.ShutdownWaitSeconds,
 	}
 
 	m, err := minion.New("minion", mcfg)
@@ -33,6 +36,7 @@ func setupJobs(s *Server) error {
 		DB:           s.DB,
 		keepFinished: s.Config.KeepFinishedJobs,
 		keepFailed:   s.Config.KeepFailedJobs,
+		keepDead:     s.Config.KeepDeadJobs,
 	}
 	if _, err := m.ScheduleFunc("0 0 8 * * *", "jobs_cleanup", j.jobs_cleanup); err != nil {
 		return err
@@ -57,6 +61,7 @@ type Jobs struct {
 
 	keepFinished int
 	keepFailed   int
+	keepDead     int
 }
 
 func (j *Jobs) Start(ctx context.Context) error {
@@ -64,8 +69,7 @@ func (j *Jobs) Start(ctx context.Context) error {
 }
 
 func (j *Jobs) Stop() error {
-	j.Minion.Stop()
-	return nil
+	return j.Minion.Stop(context.Background())
 }
 
 func (j *Jobs) jobs_cleanup() error {
@@ -74,10 +78,18 @@ func (j *Jobs) jobs_cleanup() error {
 		return fae.Errorf("cleaning up finished jobs: %w", err)
 	}
 
-	_, err = j.DB.Jobs.Collection.DeleteMany(context.Background(), bson.M{"updated_at": bson.M{"$lt": time.Now().Add(-time.Hour * time.Duration(j.keepFailed))}})
+	// only jobs that won't run again, scheduled and waiting jobs can be
+	// untouched for longer than that
+	done := bson.A{database.StatusFailed, database.StatusCancelled, database.StatusArchived}
+	_, err = j.DB.Jobs.Collection.DeleteMany(context.Background(), bson.M{"status": bson.M{"$in": done}, "updated_at": bson.M{"$lt": time.Now().Add(-time.Hour * time.Duration(j.keepFailed))}})
 	if err != nil {
 		return fae.Errorf("cleaning up failed jobs: %w", err)
 	}
+
+	_, err = j.DB.PurgeDead(context.Background(), "", time.Now().Add(-time.Hour*time.Duration(j.keepDead)))
+	if err != nil {
+		return fae.Errorf("cleaning up dead jobs: %w", err)
+	}
 	return nil
 }
 
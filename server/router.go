@@ -2,15 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"go.elastic.co/apm/module/apmechov4/v2"
 	"go.infratographer.com/x/echox/echozap"
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 
 	"github.com/dashotv/fae"
@@ -58,6 +60,27 @@ func setupRouter(s *Server) error {
 	g.PATCH("/:id", r.handlePatch)
 	g.PUT("/:id", r.handleUpdate)
 	g.DELETE("/:id", r.handleDelete)
+	g.POST("/:id/cancel", r.handleCancel)
+	g.GET("/:id/attempts/:n/logs", r.handleAttemptLogs)
+
+	b := e.Group("/batches")
+	b.GET("", r.handleBatchList)
+	b.GET("/", r.handleBatchList)
+	b.GET("/:id", r.handleBatchGet)
+
+	q := e.Group("/queues")
+	q.GET("", r.handleQueueList)
+	q.GET("/", r.handleQueueList)
+	q.POST("/:name/pause", r.handleQueuePause)
+	q.POST("/:name/resume", r.handleQueueResume)
+	q.POST("/:name/concurrency", r.handleQueueConcurrency)
+
+	d := e.Group("/dead")
+	d.GET("", r.handleDeadList)
+	d.GET("/", r.handleDeadList)
+	d.DELETE("", r.handleDeadPurge)
+	d.DELETE("/", r.handleDeadPurge)
+	d.POST("/:id/resurrect", r.handleDeadResurrect)
 
 	s.Router = r
 	return nil
@@ -118,6 +141,7 @@ func (r *Router) handleList(c echo.Context) error {
 	client := c.QueryParam("client")
 	skip := (page - 1) * limit
 	status := c.QueryParam("status")
+	tag := c.QueryParam("tag")
 
 	stats, err := r.jobStats()
 	if err != nil {
@@ -132,6 +156,9 @@ func (r *Router) handleList(c echo.Context) error {
 	if status != "" {
 		q = q.Where("status", status)
 	}
+	if tag != "" {
+		q = q.Where("tags", tag)
+	}
 
 	list, err := q.Run()
 	if err != nil {
@@ -153,11 +180,12 @@ func (r *Router) handleCreate(c echo.Context) error {
 	}
 
 	j := &database.Model{
-		Kind:   kind,
-		Client: client,
-		Args:   "{}",
-		Queue:  "default",
-		Status: string(database.StatusPending),
+		Kind:     kind,
+		Client:   client,
+		Args:     "{}",
+		Queue:    "default",
+		Status:   string(database.StatusPending),
+		Priority: QueryParamInt(c, "priority", 0),
 	}
 
 	if err := r.DB.Jobs.Save(j); err != nil {
@@ -175,51 +203,282 @@ func (r *Router) handleDelete(c echo.Context) error {
 	hard := c.QueryParam("hard") == "true"
 
 	if id == string(database.StatusPending) && !hard {
-		filter := bson.M{"status": database.StatusPending}
-		if _, err := r.DB.Jobs.Collection.UpdateMany(context.Background(), filter, bson.M{"$set": bson.M{"status": database.StatusCancelled}}); err != nil {
+		if _, err := r.DB.SetStatuses(context.Background(), database.StatusPending, database.StatusCancelled); err != nil {
 			return err
 		}
 		return c.JSON(http.StatusOK, H{"error": false})
 	} else if id == string(database.StatusFailed) && hard {
-		filter := bson.M{"status": database.StatusFailed}
-		if _, err := r.DB.Jobs.Collection.UpdateMany(context.Background(), filter, bson.M{"$set": bson.M{"status": database.StatusArchived}}); err != nil {
+		if _, err := r.DB.SetStatuses(context.Background(), database.StatusFailed, database.StatusArchived); err != nil {
 			return err
 		}
 		return c.JSON(http.StatusOK, H{"error": false})
 	} else if id == string(database.StatusCancelled) && hard {
-		filter := bson.M{"status": database.StatusCancelled}
-		if _, err := r.DB.Jobs.Collection.UpdateMany(context.Background(), filter, bson.M{"$set": bson.M{"status": database.StatusArchived}}); err != nil {
+		if _, err := r.DB.SetStatuses(context.Background(), database.StatusCancelled, database.StatusArchived); err != nil {
 			return err
 		}
 		return c.JSON(http.StatusOK, H{"error": false})
 	}
 
+	if err := r.Jobs.Minion.Cancel(id); err != nil {
+		return c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, H{"error": false})
+}
+
+// handleCancel cancels a job, running jobs are cancelled by the process
+// running them
+func (r *Router) handleCancel(c echo.Context) error {
+	id := c.Param("id")
+	if id == "" {
+		return fae.New("missing id")
+	}
+	if err := r.Jobs.Minion.Cancel(id); err != nil {
+		return c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, H{"error": false})
+}
+
+// handleGet returns a job, including its result, from the jobs or dead
+// collection
+func (r *Router) handleGet(c echo.Context) error {
+	id := c.Param("id")
+	if id == "" {
+		return fae.New("missing id")
+	}
+
 	j, err := r.DB.Jobs.Get(id, &database.Model{})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		j, err = r.DB.Dead.Get(id, &database.Model{})
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.JSON(http.StatusNotFound, H{"error": "not found"})
+	}
 	if err != nil {
 		return err
 	}
 
-	j.Status = string(database.StatusCancelled)
-	if err := r.DB.Jobs.Save(j); err != nil {
+	return c.JSON(http.StatusOK, H{"error": false, "result": j})
+}
+func (r *Router) handlePatch(c echo.Context) error {
+	id := c.Param("id")
+	if id == "" {
+		return fae.New("missing id")
+	}
+	if err := r.Jobs.Minion.Requeue(id); err != nil {
+		return c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, H{"error": false})
+}
+
+// handleUpdate updates the priority of a job
+func (r *Router) handleUpdate(c echo.Context) error {
+	id := c.Param("id")
+	if id == "" {
+		return fae.New("missing id")
+	}
+	if c.QueryParam("priority") == "" {
+		return fae.New("missing priority")
+	}
+	priority, err := strconv.Atoi(c.QueryParam("priority"))
+	if err != nil {
+		return fae.Wrap(err, "invalid priority")
+	}
+
+	if err := r.DB.SetPriority(context.Background(), id, priority); err != nil {
 		return err
 	}
 
 	return c.JSON(http.StatusOK, H{"error": false})
 }
 
-func (r *Router) handleGet(c echo.Context) error {
-	return c.JSON(http.StatusNotImplemented, H{"error": "not implemented"})
+func (r *Router) handleDeadList(c echo.Context) error {
+	page := QueryParamInt(c, "page", 1)
+	limit := QueryParamInt(c, "limit", pagesize)
+	client := c.QueryParam("client")
+	skip := (page - 1) * limit
+
+	q := r.DB.Dead.Query().Limit(limit).Skip(skip).Desc("updated_at")
+	if client != "" {
+		q = q.Where("client", client)
+	}
+
+	total, err := q.Count()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+	}
+
+	list, err := q.Run()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, H{"error": false, "total": total, "results": list})
 }
-func (r *Router) handlePatch(c echo.Context) error {
+
+func (r *Router) handleDeadResurrect(c echo.Context) error {
 	id := c.Param("id")
 	if id == "" {
 		return fae.New("missing id")
 	}
-	if err := r.Jobs.Minion.Requeue(id); err != nil {
+
+	j, err := r.DB.Resurrect(context.Background(), id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, H{"error": false, "result": j})
+}
+
+// handleDeadPurge deletes dead jobs of a client, or older than a number
+// of hours, one of them is required
+func (r *Router) handleDeadPurge(c echo.Context) error {
+	client := c.QueryParam("client")
+	hours := QueryParamInt(c, "hours", 0)
+	if client == "" && hours <= 0 {
+		return c.JSON(http.StatusBadRequest, H{"error": "client or hours required"})
+	}
+
+	before := time.Time{}
+	if hours > 0 {
+		before = time.Now().Add(-time.Hour * time.Duration(hours))
+	}
+
+	count, err := r.DB.PurgeDead(context.Background(), client, before)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, H{"error": false, "count": count})
+}
+
+func (r *Router) handleBatchList(c echo.Context) error {
+	page := QueryParamInt(c, "page", 1)
+	limit := QueryParamInt(c, "limit", pagesize)
+	client := c.QueryParam("client")
+	status := c.QueryParam("status")
+	skip := (page - 1) * limit
+
+	q := r.DB.Batches.Query().Limit(limit).Skip(skip).Desc("created_at")
+	if client != "" {
+		q = q.Where("client", client)
+	}
+	if status != "" {
+		q = q.Where("status", status)
+	}
+
+	list, err := q.Run()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+	}
+
+	results := make([]*BatchProgress, len(list))
+	for i, b := range list {
+		results[i] = newBatchProgress(b)
+	}
+
+	return c.JSON(http.StatusOK, H{"error": false, "results": results})
+}
+
+func (r *Router) handleBatchGet(c echo.Context) error {
+	id := c.Param("id")
+	if id == "" {
+		return fae.New("missing id")
+	}
+
+	b, err := r.DB.Batches.Get(id, &database.Batch{})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, H{"error": false, "result": newBatchProgress(b)})
+}
+
+func (r *Router) handleQueueList(c echo.Context) error {
+	list, err := r.DB.ListQueues(context.Background(), c.QueryParam("client"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, H{"error": false, "results": list})
+}
+
+// handleQueuePause pauses a queue, the client defaults to the server's
+func (r *Router) handleQueuePause(c echo.Context) error {
+	return r.setQueuePaused(c, true)
+}
+
+// handleQueueResume resumes a queue, the client defaults to the server's
+func (r *Router) handleQueueResume(c echo.Context) error {
+	return r.setQueuePaused(c, false)
+}
+
+// handleQueueConcurrency sets the number of runners of a queue, 0 resets
+// it to the queue's configured concurrency, the client defaults to the
+// server's
+func (r *Router) handleQueueConcurrency(c echo.Context) error {
+	name := c.Param("name")
+	if name == "" {
+		return fae.New("missing name")
+	}
+	if c.QueryParam("n") == "" {
+		return fae.New("missing n")
+	}
+	n := QueryParamInt(c, "n", 0)
+	if n < 0 {
+		return fae.Errorf("invalid concurrency: %d", n)
+	}
+	client := c.QueryParam("client")
+	if client == "" {
+		client = r.Jobs.Minion.Client
+	}
+
+	if err := r.DB.SetQueueConcurrency(context.Background(), client, name, n); err != nil {
 		return c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
 	}
 	return c.JSON(http.StatusOK, H{"error": false})
 }
-func (r *Router) handleUpdate(c echo.Context) error {
-	return c.JSON(http.StatusNotImplemented, H{"error": "not implemented"})
+
+func (r *Router) setQueuePaused(c echo.Context, paused bool) error {
+	name := c.Param("name")
+	if name == "" {
+		return fae.New("missing name")
+	}
+	client := c.QueryParam("client")
+	if client == "" {
+		client = r.Jobs.Minion.Client
+	}
+
+	if err := r.DB.SetQueuePaused(context.Background(), client, name, paused); err != nil {
+		return c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, H{"error": false})
+}
+
+// handleAttemptLogs returns the logs of a job's attempt, n starts at 1
+func (r *Router) handleAttemptLogs(c echo.Context) error {
+	id := c.Param("id")
+	if id == "" {
+		return fae.New("missing id")
+	}
+	n, err := strconv.Atoi(c.Param("n"))
+	if err != nil {
+		return fae.Errorf("invalid attempt: %s", c.Param("n"))
+	}
+
+	j, err := r.DB.Jobs.Get(id, &database.Model{})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		j, err = r.DB.Dead.Get(id, &database.Model{})
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.JSON(http.StatusNotFound, H{"error": "not found"})
+	}
+	if err != nil {
+		return err
+	}
+
+	if n < 1 || n > len(j.Attempts) {
+		return c.JSON(http.StatusNotFound, H{"error": "attempt not found"})
+	}
+
+	return c.JSON(http.StatusOK, H{"error": false, "result": j.Attempts[n-1].Logs})
 }
@@ -6,6 +6,8 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/dashotv/minion/database"
 )
 
 type H map[string]interface{}
@@ -38,11 +40,21 @@ func (r *Router) jobStats() (*Stats, error) {
 		return nil, err
 	}
 
+	dead, err := r.DB.Dead.Query().Count()
+	if err != nil {
+		return nil, err
+	}
+
 	stats := &Stats{
 		Total: total,
+		Dead:  dead,
 	}
 	for _, raw := range list {
 		switch raw.ID {
+		case "waiting":
+			stats.Waiting = raw.Count
+		case "scheduled":
+			stats.Scheduled = raw.Count
 		case "pending":
 			stats.Pending = raw.Count
 		case "queued":
@@ -69,6 +81,8 @@ type result struct {
 
 type Stats struct {
 	Total     int64 `json:"total"`
+	Waiting   int64 `json:"waiting"`
+	Scheduled int64 `json:"scheduled"`
 	Pending   int64 `json:"pending"`
 	Queued    int64 `json:"queued"`
 	Running   int64 `json:"running"`
@@ -76,4 +90,15 @@ type Stats struct {
 	Failed    int64 `json:"failed"`
 	Archived  int64 `json:"archived"`
 	Finished  int64 `json:"finished"`
+	Dead      int64 `json:"dead"`
+}
+
+// BatchProgress is a batch with its count of unfinished jobs
+type BatchProgress struct {
+	*database.Batch
+	Pending int `json:"pending"`
+}
+
+func newBatchProgress(b *database.Batch) *BatchProgress {
+	return &BatchProgress{Batch: b, Pending: b.Pending()}
 }
@@ -0,0 +1,47 @@
+package minion
+
+import (
+	"context"
+	"time"
+)
+
+// slotName returns the name of the kind's concurrency slots.
+func (m *Minion) slotName(kind string) string {
+	return m.Client + ":" + kind
+}
+
+// slotTTL is how long a slot is held without being renewed, slots are
+// renewed with the instance's heartbeat.
+func (m *Minion) slotTTL() time.Duration {
+	return time.Duration(m.Config.HeartbeatTimeout) * time.Second
+}
+
+// limited returns true if any of the registered kinds has a MaxConcurrent.
+func (m *Minion) limited() bool {
+	for _, w := range m.workers {
+		if w.concurrency > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseSlots releases the concurrency slots held by the jobs.
+func (m *Minion) releaseSlots(ids ...string) {
+	if !m.limited() {
+		return
+	}
+	if err := m.db.ReleaseSlots(context.Background(), ids); err != nil {
+		m.Log.Errorf("releasing slots: %s", err)
+	}
+}
+
+// acquireSlot takes one of the kind's concurrency slots for a claimed
+// job, returns true if the kind has no limit.
+func (p *Producer) acquireSlot(ctx context.Context, kind, jobID string) (bool, error) {
+	w, ok := p.Minion.workers[kind]
+	if !ok || w.concurrency == 0 {
+		return true, nil
+	}
+	return p.Minion.db.AcquireSlot(ctx, p.Minion.slotName(kind), jobID, p.Minion.Instance, w.concurrency, p.Minion.slotTTL())
+}
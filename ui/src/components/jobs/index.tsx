@@ -2,4 +2,5 @@ export * from './dialog';
 export * from './types';
 export * from './query';
 export * from './list';
+export * from './queues';
 export * from './stats';
@@ -2,7 +2,7 @@ import axios from 'axios';
 
 import { useQuery } from '@tanstack/react-query';
 
-import { JobsResponse, Stats } from './types';
+import { JobsResponse, QueueState, Stats } from './types';
 
 export const getJobsFor = async (id: string, page: number) => {
   const response = await axios.get(`/api/minion/jobs/?page=${page}&client=${id}`);
@@ -33,6 +33,26 @@ export const patchJob = async (id: string) => {
   return response.data;
 };
 
+export const getQueues = async (client: string) => {
+  const response = await axios.get(`/api/minion/queues?client=${client}`);
+  return response.data.results as QueueState[];
+};
+
+export const pauseQueue = async (name: string, client: string) => {
+  const response = await axios.post(`/api/minion/queues/${name}/pause?client=${client}`);
+  return response.data;
+};
+
+export const resumeQueue = async (name: string, client: string) => {
+  const response = await axios.post(`/api/minion/queues/${name}/resume?client=${client}`);
+  return response.data;
+};
+
+export const setQueueConcurrency = async (name: string, client: string, n: number) => {
+  const response = await axios.post(`/api/minion/queues/${name}/concurrency?client=${client}&n=${n}`);
+  return response.data;
+};
+
 export const useJobsStatsQuery = () =>
   useQuery({
     queryKey: ['jobs', 'stats'],
@@ -56,3 +76,11 @@ export const useJobsForQuery = (id: string, page: number) =>
     placeholderData: previousData => previousData,
     retry: false,
   });
+
+export const useQueuesQuery = (client: string) =>
+  useQuery({
+    queryKey: ['queues', client],
+    queryFn: () => getQueues(client),
+    placeholderData: previousData => previousData,
+    retry: false,
+  });
@@ -0,0 +1,123 @@
+import AddIcon from '@mui/icons-material/Add';
+import PauseIcon from '@mui/icons-material/Pause';
+import PlayArrowIcon from '@mui/icons-material/PlayArrow';
+import RemoveIcon from '@mui/icons-material/Remove';
+import RestartAltIcon from '@mui/icons-material/RestartAlt';
+import { IconButton, Paper, Stack, Typography } from '@mui/material';
+
+import { Row } from '@dashotv/components';
+import { useQueryClient } from '@tanstack/react-query';
+
+import { QueueState, pauseQueue, resumeQueue, setQueueConcurrency, useQueuesQuery } from '.';
+
+export function Queues({ client }: { client: string }) {
+  const queryClient = useQueryClient();
+  const { data } = useQueuesQuery(client);
+
+  const refresh = () => queryClient.invalidateQueries({ queryKey: ['queues'] });
+
+  const handlePause = (queue: QueueState) => {
+    const action = queue.paused ? resumeQueue : pauseQueue;
+    action(queue.name, queue.client).then(refresh);
+  };
+
+  // 0 resets the queue to its configured concurrency
+  const handleConcurrency = (queue: QueueState, n: number) => {
+    if (n < 0) return;
+    setQueueConcurrency(queue.name, queue.client, n).then(refresh);
+  };
+
+  if (!data || data.length === 0) {
+    return (
+      <Paper elevation={0}>
+        <Typography color="gray" variant="caption">
+          No queues
+        </Typography>
+      </Paper>
+    );
+  }
+
+  return (
+    <Paper elevation={0}>
+      {data.map(queue => (
+        <QueueRow key={`${queue.client}:${queue.name}`} {...{ queue, handlePause, handleConcurrency }} />
+      ))}
+    </Paper>
+  );
+}
+
+export function QueueRow({
+  queue,
+  handlePause,
+  handleConcurrency,
+}: {
+  queue: QueueState;
+  handlePause: (queue: QueueState) => void;
+  handleConcurrency: (queue: QueueState, n: number) => void;
+}) {
+  const { client, name, paused, concurrency, configured } = queue;
+  // the configured concurrency is unknown until a process with the queue
+  // has started, resizing is disabled until then
+  const effective = concurrency || configured;
+  return (
+    <Row>
+      <Stack width="100%" direction="row" spacing={1} alignItems="center" justifyContent="space-between">
+        <Stack direction="row" spacing={1} alignItems="center">
+          <Typography variant="button" color="gray" noWrap>
+            {client}
+          </Typography>
+          <Typography color={paused ? 'warning.main' : 'primary'} noWrap>
+            {name}
+          </Typography>
+          {paused && (
+            <Typography variant="caption" color="warning.main">
+              paused
+            </Typography>
+          )}
+        </Stack>
+        <Stack direction="row" spacing={0} alignItems="center">
+          <IconButton
+            size="small"
+            title="Fewer runners"
+            disabled={effective <= 1}
+            onClick={() => handleConcurrency(queue, effective - 1)}
+          >
+            <RemoveIcon fontSize="small" />
+          </IconButton>
+          <Typography
+            variant="caption"
+            title={concurrency ? `Runners, configured ${configured || 'unknown'}` : 'Runners'}
+            color={concurrency ? 'warning.main' : 'inherit'}
+            minWidth="2em"
+            textAlign="center"
+          >
+            {effective || '-'}
+          </Typography>
+          <IconButton
+            size="small"
+            title="More runners"
+            disabled={!effective}
+            onClick={() => handleConcurrency(queue, effective + 1)}
+          >
+            <AddIcon fontSize="small" />
+          </IconButton>
+          <IconButton
+            size="small"
+            title="Reset runners"
+            disabled={!concurrency}
+            onClick={() => handleConcurrency(queue, 0)}
+          >
+            <RestartAltIcon fontSize="small" />
+          </IconButton>
+          <IconButton size="small" title={paused ? 'Resume' : 'Pause'} onClick={() => handlePause(queue)}>
+            {paused ? (
+              <PlayArrowIcon color="primary" fontSize="small" />
+            ) : (
+              <PauseIcon color="warning" fontSize="small" />
+            )}
+          </IconButton>
+        </Stack>
+      </Stack>
+    </Row>
+  );
+}
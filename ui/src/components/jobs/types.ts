@@ -9,27 +9,65 @@ export interface Job {
   client: string;
   kind: string;
   queue: string;
+  priority: number;
+  max_attempts?: number;
+  timeout?: number;
+  tags?: string[];
+  batch_id?: string;
+  unique_key?: string;
+  unique_states?: string[];
   args: string;
   status: string;
   attempts: JobAttempt[];
+  result?: string;
+  progress?: JobProgress;
+  after_jobs?: string[];
+  run_on_parent_failure?: boolean;
+  cancel_requested?: boolean;
+  owner?: string;
+  heartbeat_at?: Date;
+  run_at?: Date;
+  retry_at?: Date;
   created_at: Date;
   updated_at: Date;
 }
 
+export interface JobProgress {
+  percent: number;
+  message?: string;
+  updated_at: Date;
+}
+
 export interface JobAttempt {
   started_at: Date;
   duration: number;
   status: string;
   error: string;
   stacktrace: string[];
+  retry_at?: Date;
+  retry_reason?: string;
 }
 
 export interface Stats {
   total: number;
+  waiting: number;
+  scheduled: number;
   pending: number;
   queued: number;
   running: number;
   cancelled: number;
   failed: number;
   archived: number;
+  dead: number;
+}
+
+export interface QueueState {
+  id: string;
+  client: string;
+  name: string;
+  paused: boolean;
+  concurrency: number;
+  configured: number;
+  created_at: Date;
+  updated_at: Date;
 }
@@ -9,7 +9,7 @@ import { ThemeProvider, createTheme } from '@mui/material/styles';
 import { Container, FilterSelect, Option, RoutingTabs, RoutingTabsRoute } from '@dashotv/components';
 import { QueryClient, QueryClientProvider } from '@tanstack/react-query';
 
-import { Jobs, useJobsStatsQuery } from 'components/jobs';
+import { Jobs, Queues, useJobsStatsQuery } from 'components/jobs';
 
 const darkTheme = createTheme({
   palette: {
@@ -70,6 +70,7 @@ export const Routes = ({ mount }: { mount: string }) => {
   useInterval(() => {
     console.log('invalidate');
     queryClient.invalidateQueries({ queryKey: ['jobs'] });
+    queryClient.invalidateQueries({ queryKey: ['queues'] });
   }, 5000);
 
   const tabsMap: RoutingTabsRoute[] = [
@@ -108,6 +109,11 @@ export const Routes = ({ mount }: { mount: string }) => {
       to: 'archived',
       element: <Jobs client={client} status="archived" />,
     },
+    {
+      label: 'Queues',
+      to: 'queues',
+      element: <Queues client={client} />,
+    },
   ];
 
   return (
@@ -0,0 +1,104 @@
+package minion
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dashotv/minion/database"
+)
+
+// defaultUniqueStates are the statuses in which an existing job blocks
+// a duplicate, unless UniqueOpts.States is set.
+var defaultUniqueStates = []database.Status{
+	database.StatusWaiting,
+	database.StatusScheduled,
+	database.StatusPending,
+	database.StatusQueued,
+	database.StatusRunning,
+}
+
+// allUniqueStates are all of the statuses a job can have in the jobs
+// collection, jobs unique by period, and batch callbacks, hold their lock
+// in every one of them.
+var allUniqueStates = []database.Status{
+	database.StatusWaiting,
+	database.StatusScheduled,
+	database.StatusPending,
+	database.StatusQueued,
+	database.StatusRunning,
+	database.StatusSnoozed,
+	database.StatusFailed,
+	database.StatusFinished,
+	database.StatusCancelled,
+	database.StatusArchived,
+}
+
+// UniqueOpts deduplicate jobs, a job is not enqueued while another job
+// with the same key is in one of the states. Uniqueness is enforced by
+// a partial unique index in the database.
+type UniqueOpts struct {
+	// Key identifies duplicate jobs, defaults to a hash of the kind and args.
+	Key string
+	// States are the statuses of the existing job that count as a duplicate,
+	// defaults to waiting, scheduled, pending, queued and running. A job
+	// passes through the earlier of those statuses to reach the later ones,
+	// so they are added too, e.g. running also locks waiting to queued.
+	States []database.Status
+	// Period limits uniqueness to jobs enqueued in the same window of time.
+	// With a Period, the job blocks duplicates in its window whatever its
+	// status, even once it has finished, and States is ignored.
+	Period time.Duration
+}
+
+// apply sets the unique key and states on the job.
+func (u *UniqueOpts) apply(data *database.Model) {
+	key := u.Key
+	if key == "" {
+		sum := sha256.Sum256([]byte(data.Kind + ":" + data.Args))
+		key = hex.EncodeToString(sum[:])
+	}
+	if u.Period > 0 {
+		key = fmt.Sprintf("%s:%d", key, time.Now().Truncate(u.Period).Unix())
+	}
+
+	states := u.States
+	if len(states) == 0 {
+		states = defaultUniqueStates
+	}
+	states = uniqueStates(states)
+	if u.Period > 0 {
+		states = allUniqueStates
+	}
+
+	data.UniqueKey = key
+	data.UniqueStates = make([]string, len(states))
+	for i, s := range states {
+		data.UniqueStates[i] = string(s)
+	}
+}
+
+// uniqueStates adds the statuses a job passes through to reach the
+// given ones. Otherwise two duplicates could both be pending, and the
+// second would fail to move to the locked status, leaving it stuck.
+func uniqueStates(states []database.Status) []database.Status {
+	last := -1
+	for _, s := range states {
+		i := slices.Index(defaultUniqueStates, s)
+		if i < 0 {
+			// done statuses are reached through all of them
+			i = len(defaultUniqueStates) - 1
+		}
+		last = max(last, i)
+	}
+
+	list := slices.Clone(defaultUniqueStates[:last+1])
+	for _, s := range states {
+		if !slices.Contains(list, s) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,56 @@
+package minion
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dashotv/minion/database"
+)
+
+func TestUniqueOptsPeriod(t *testing.T) {
+	d := &database.Model{Kind: "test", Args: "{}"}
+	u := &UniqueOpts{States: []database.Status{database.StatusPending}, Period: time.Hour}
+	u.apply(d)
+
+	for _, s := range []database.Status{database.StatusPending, database.StatusRunning, database.StatusFinished, database.StatusFailed} {
+		if !slices.Contains(d.UniqueStates, string(s)) {
+			t.Errorf("period unique states missing %s: %v", s, d.UniqueStates)
+		}
+	}
+}
+
+func TestUniqueOptsStates(t *testing.T) {
+	cases := []struct {
+		states []database.Status
+		want   []database.Status
+	}{
+		{nil, defaultUniqueStates},
+		{
+			[]database.Status{database.StatusRunning},
+			defaultUniqueStates,
+		},
+		{
+			[]database.Status{database.StatusPending},
+			[]database.Status{database.StatusWaiting, database.StatusScheduled, database.StatusPending},
+		},
+		{
+			[]database.Status{database.StatusFinished},
+			append(slices.Clone(defaultUniqueStates), database.StatusFinished),
+		},
+	}
+
+	for _, c := range cases {
+		d := &database.Model{Kind: "test", Args: "{}"}
+		u := &UniqueOpts{States: c.states}
+		u.apply(d)
+
+		want := make([]string, len(c.want))
+		for i, s := range c.want {
+			want[i] = string(s)
+		}
+		if !slices.Equal(d.UniqueStates, want) {
+			t.Errorf("states %v = %v, want %v", c.states, d.UniqueStates, want)
+		}
+	}
+}
@@ -7,3 +7,27 @@ func channelBufferFull[T any](ch chan T) bool {
 func channelBufferRemaining[T any](ch chan T) int {
 	return cap(ch) - len(ch)
 }
+
+// drain receives everything in the channel's buffer without blocking.
+func drain[T any](ch chan T) []T {
+	list := []T{}
+	for {
+		select {
+		case v := <-ch:
+			list = append(list, v)
+		default:
+			return list
+		}
+	}
+}
+
+// channelClosed returns true if the channel, which is only ever closed,
+// has been closed.
+func channelClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,155 @@
+package minion
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/dashotv/fae"
+	"github.com/dashotv/minion/database"
+)
+
+// Outcome is the final state of a job, returned by Wait.
+type Outcome struct {
+	Status database.Status
+	// Error is the error from the job's last attempt.
+	Error string
+	// Result is the JSON result from a WorkerWithResult.
+	Result string
+}
+
+// ErrJobNotFound is returned by Wait when the job doesn't exist, it was
+// never enqueued or it has been removed. Jobs discarded by another
+// process can't be told apart from removed jobs and also return it.
+var ErrJobNotFound = fae.New("job not found")
+
+// EnqueueAndWait enqueues a job and waits for it to be done.
+func (m *Minion) EnqueueAndWait(ctx context.Context, in Payload) (*Outcome, error) {
+	id, err := m.EnqueueID(in)
+	if err != nil {
+		return nil, err
+	}
+	return m.Wait(ctx, id)
+}
+
+// Wait blocks until the job is done or the context is cancelled. When
+// the job runs in this process it is woken by notifications, otherwise
+// it polls the database at the polling interval.
+func (m *Minion) Wait(ctx context.Context, jobID string) (*Outcome, error) {
+	ch := m.addWaiter(jobID)
+	defer m.removeWaiter(jobID, ch)
+
+	ticker := time.NewTicker(time.Duration(m.Config.PollingInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		o, err := m.outcome(jobID)
+		if err != nil {
+			return nil, err
+		}
+		if o.Status.Done() {
+			return o, nil
+		}
+
+		select {
+		case <-ch:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// outcome returns the current state of the job. A job that no longer
+// exists is only known to be discarded if it was discarded by this
+// process while it was waited on.
+func (m *Minion) outcome(jobID string) (*Outcome, error) {
+	d := &database.Model{}
+	err := m.db.Jobs.Find(jobID, d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = m.db.Dead.Find(jobID, d)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if m.isDiscarded(jobID) {
+			return &Outcome{Status: database.StatusDiscarded}, nil
+		}
+		return nil, fae.Wrapf(ErrJobNotFound, "finding job: %s", jobID)
+	}
+	if err != nil {
+		return nil, fae.Wrapf(err, "finding job: %s", jobID)
+	}
+
+	o := &Outcome{Status: database.Status(d.Status), Result: d.Result}
+	if len(d.Attempts) > 0 {
+		o.Error = d.Attempts[len(d.Attempts)-1].Error
+	}
+	return o, nil
+}
+
+func (m *Minion) addWaiter(jobID string) chan struct{} {
+	m.waitersMu.Lock()
+	defer m.waitersMu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	m.waiters[jobID] = append(m.waiters[jobID], ch)
+	return ch
+}
+
+func (m *Minion) removeWaiter(jobID string, ch chan struct{}) {
+	m.waitersMu.Lock()
+	defer m.waitersMu.Unlock()
+
+	list := m.waiters[jobID]
+	for i, c := range list {
+		if c == ch {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(m.waiters, jobID)
+		delete(m.discarded, jobID)
+		return
+	}
+	m.waiters[jobID] = list
+}
+
+// discard records that a job is being discarded, if it is waited on, so
+// that its waiters don't mistake it for a job that never existed. It is
+// called before the job is deleted.
+func (m *Minion) discard(jobID string) {
+	m.waitersMu.Lock()
+	defer m.waitersMu.Unlock()
+
+	if len(m.waiters[jobID]) > 0 {
+		m.discarded[jobID] = true
+	}
+}
+
+func (m *Minion) isDiscarded(jobID string) bool {
+	m.waitersMu.Lock()
+	defer m.waitersMu.Unlock()
+	return m.discarded[jobID]
+}
+
+// wake signals the waiters of a job when the job's attempt ends, they
+// check the database to see if it is done.
+func (m *Minion) wake(n *Notification) {
+	switch n.Event {
+	case "job:success", "job:fail", "job:cancel", "job:discard", "job:dead":
+	default:
+		return
+	}
+
+	m.waitersMu.Lock()
+	defer m.waitersMu.Unlock()
+
+	for _, ch := range m.waiters[n.JobID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -12,6 +12,9 @@ import (
 	"encoding/json"
 	"time"
 
+	"go.uber.org/zap"
+
+	"github.com/dashotv/fae"
 	"github.com/dashotv/minion/database"
 )
 
@@ -20,6 +23,19 @@ type Job[T Payload] struct {
 
 	// Args are the arguments for the job.
 	Args T
+
+	minion     *Minion
+	log        *zap.SugaredLogger
+	progressAt time.Time
+}
+
+// Log returns the job's logger, its output is also saved with the
+// job's attempt.
+func (j *Job[T]) Log() *zap.SugaredLogger {
+	if j.log == nil {
+		return zap.NewNop().Sugar()
+	}
+	return j.log
 }
 
 type Payload interface {
@@ -36,22 +52,40 @@ type WorkerDefaults[T Payload] struct{}
 // will be used.
 func (w *WorkerDefaults[T]) Timeout(*Job[T]) time.Duration { return 0 }
 
+// MaxAttempts returns the maximum number of attempts for the job,
+// override this method to set a limit specific to this job, otherwise
+// the default max attempts will be used.
+func (w *WorkerDefaults[T]) MaxAttempts(*Job[T]) int { return 0 }
+
 // Worker is the interface that must be implemented by all workers.
 type Worker[T Payload] interface {
 	Timeout(*Job[T]) time.Duration
+	MaxAttempts(*Job[T]) int
 	Work(ctx context.Context, job *Job[T]) error
 }
 
+// RetryPolicy is an optional interface that workers can implement to
+// decide for themselves when, or whether, a failed job is retried.
+// Return false to stop retrying, the job's MaxAttempts still applies.
+type RetryPolicy[T Payload] interface {
+	NextRetry(job *Job[T], attempt int, err error) (time.Time, bool)
+}
+
 type wrapped interface {
 	Unmarshal() error
 	Timeout() time.Duration
+	MaxAttempts() int
+	NextRetry(attempt int, err error) (at time.Time, retry bool, ok bool)
+	SetLog(log *zap.SugaredLogger)
 	Work(ctx context.Context) error
 }
 
 type wrappedWorker[T Payload] struct {
 	job    *Job[T]
+	minion *Minion
 	data   *database.Model
 	worker Worker[T]
+	policy RetryPolicy[T]
 }
 
 func (w *wrappedWorker[T]) Work(ctx context.Context) error {
@@ -62,21 +96,77 @@ func (w *wrappedWorker[T]) Timeout() time.Duration {
 	return w.worker.Timeout(w.job)
 }
 
+func (w *wrappedWorker[T]) MaxAttempts() int {
+	return w.worker.MaxAttempts(w.job)
+}
+
+// NextRetry calls the worker's RetryPolicy, ok is false if the worker
+// doesn't implement one.
+func (w *wrappedWorker[T]) NextRetry(attempt int, err error) (time.Time, bool, bool) {
+	if w.policy == nil {
+		return time.Time{}, false, false
+	}
+	at, retry := w.policy.NextRetry(w.job, attempt, err)
+	return at, retry, true
+}
+
+func (w *wrappedWorker[T]) SetLog(log *zap.SugaredLogger) {
+	w.job.log = log
+}
+
 func (w *wrappedWorker[T]) Unmarshal() error {
 	w.job = &Job[T]{
-		Model: w.data,
+		Model:  w.data,
+		minion: w.minion,
 	}
 	return json.Unmarshal([]byte(w.data.Args), &w.job.Args)
 }
 
 type factory interface {
-	Create(data *database.Model) wrapped
+	Create(m *Minion, data *database.Model) wrapped
 }
 
 type workerFactory[T Payload] struct {
 	worker Worker[T]
+	policy RetryPolicy[T]
 }
 
-func (f *workerFactory[T]) Create(data *database.Model) wrapped {
-	return &wrappedWorker[T]{data: data, worker: f.worker}
+func (f *workerFactory[T]) Create(m *Minion, data *database.Model) wrapped {
+	return &wrappedWorker[T]{minion: m, data: data, worker: f.worker, policy: f.policy}
+}
+
+// WorkerWithResult is the interface for workers that return a result,
+// the result is stored as JSON with the job and can be fetched with
+// Result. Register these workers with RegisterWithResult.
+type WorkerWithResult[T Payload, R any] interface {
+	Timeout(*Job[T]) time.Duration
+	MaxAttempts(*Job[T]) int
+	Work(ctx context.Context, job *Job[T]) (R, error)
+}
+
+// resultWorker adapts a WorkerWithResult to a Worker.
+type resultWorker[T Payload, R any] struct {
+	worker WorkerWithResult[T, R]
+}
+
+func (w *resultWorker[T, R]) Timeout(job *Job[T]) time.Duration {
+	return w.worker.Timeout(job)
+}
+
+func (w *resultWorker[T, R]) MaxAttempts(job *Job[T]) int {
+	return w.worker.MaxAttempts(job)
+}
+
+func (w *resultWorker[T, R]) Work(ctx context.Context, job *Job[T]) error {
+	result, err := w.worker.Work(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fae.Wrap(err, "marshaling job result")
+	}
+	job.Result = string(data)
+	return nil
 }